@@ -14,13 +14,13 @@ package turretIO
 
 import (
     "bytes"
-    "crypto/hmac"
-    "crypto/sha512"
+	"context"
     "encoding/base64"
     "encoding/json"
+	"errors"
     "fmt"
     "io/ioutil"
-    _ "log"
+	"log/slog"
     "net/http"
     "strconv"
     "strings"
@@ -28,12 +28,27 @@ import (
 )
 
 const ENDPOINT = "https://api.turret.io"
+const DEFAULT_API_VERSION = "latest"
+
+// Resource paths are relative to the configured base URL and API version
+const USER_RESOURCE_PATH = "/user"
+const TARGET_EMAIL_RESOURCE_PATH = "/target"
+const TARGET_RESOURCE_PATH = "/target"
+const ACCOUNT_RESOURCE_PATH = "/account"
+
+// Deprecated: use USER_RESOURCE_PATH, which follows WithAPIVersion
 const USER_PATH = "/latest/user"
+
+// Deprecated: use TARGET_EMAIL_RESOURCE_PATH, which follows WithAPIVersion
 const TARGET_EMAIL_PATH = "/latest/target"
+
+// Deprecated: use TARGET_RESOURCE_PATH, which follows WithAPIVersion
 const TARGET_PATH = "/latest/target"
+
+// Deprecated: use ACCOUNT_RESOURCE_PATH, which follows WithAPIVersion
 const ACCOUNT_PATH = "/latest/account"
 
-const OUTGOING_METHOD_OPTIONS_REGEXP="(turret\\.io|aws|smtp)"
+const OUTGOING_METHOD_OPTIONS_REGEXP = "^(turret\\.io|aws|smtp)$"
 const OUTGOING_METHOD_TURRET_IO_NAME="turret.io"
 const OUTGOING_METHOD_AWS_NAME="aws"
 const OUTGOING_METHOD_SMTP_NAME="smtp"
@@ -43,6 +58,9 @@ const AWS_SECRET_ACCESS_KEY_NAME="aws_secret_access_key"
 const SMTP_HOST_NAME="smtp_host"
 const SMTP_USERNAME_NAME="smtp_username"
 const SMTP_PASSWORD_NAME="smtp_password"
+const AWS_REGION_NAME = "aws_region"
+const SMTP_PORT_NAME = "smtp_port"
+const SMTP_TLS_MODE_NAME = "smtp_tls_mode"
 
 // NewTurretIO is used to create a new TurretIO base instance to be provided
 // to other types during instantiation
@@ -53,15 +71,55 @@ func NewTurretIO(api_key string, api_secret string) *TurretIO {
     return t
 }
 
+// Option configures a TurretIO instance created by NewTurretIOWithOptions
+type Option func(*TurretIO)
+
+// WithBaseURL points the client at a different host, e.g. a staging
+// deployment or an httptest.Server. Defaults to ENDPOINT.
+func WithBaseURL(base_url string) Option {
+	return func(t *TurretIO) {
+		t.baseURL = strings.TrimRight(base_url, "/")
+	}
+}
+
+// WithAPIVersion sets the API version path segment. Defaults to DEFAULT_API_VERSION.
+func WithAPIVersion(version string) Option {
+	return func(t *TurretIO) {
+		t.apiVersion = strings.Trim(version, "/")
+	}
+}
+
+// WithHTTPClient sets the http.Client returned by GetHTTPClient
+func WithHTTPClient(client *http.Client) Option {
+	return func(t *TurretIO) {
+		t.httpClient = client
+	}
+}
+
+// NewTurretIOWithOptions works like NewTurretIO and applies the provided options
+func NewTurretIOWithOptions(api_key string, api_secret string, opts ...Option) *TurretIO {
+	t := NewTurretIO(api_key, api_secret)
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// TurretIOResponse holds the decoded body of a successful API call.
+// Non-2xx responses are returned as an *APIError instead.
 type TurretIOResponse struct {
 	JSONBody map[string]interface {}
 	Status	string
+	StatusCode int
+	Header     http.Header
 }
 
 type TurretInterface interface {
 	GetHTTPClient() (*http.Client)
 	GetRequest(url string, payload *map[string]interface {}, client *http.Client) (*TurretIOResponse, error)
 	PostRequest(url string, payload *map[string]interface {}, client *http.Client) (*TurretIOResponse, error)
+	GetRequestContext(ctx context.Context, url string, payload *map[string]interface{}, client *http.Client) (*TurretIOResponse, error)
+	PostRequestContext(ctx context.Context, url string, payload *map[string]interface{}, client *http.Client) (*TurretIOResponse, error)
 	GetApikey() (string)
 	GetApisecret() (string)
 }
@@ -69,6 +127,14 @@ type TurretInterface interface {
 type TurretIO struct {
     Apikey     string
     Apisecret  string
+
+	baseURL      string
+	apiVersion   string
+	httpClient   *http.Client
+	retryPolicy  *RetryPolicy
+	rateLimiters map[string]*RateLimiter
+	middleware   []Middleware
+	logger       *slog.Logger
 }
 
 func (t *TurretIO) GetApikey() (string) {
@@ -80,36 +146,116 @@ func (t *TurretIO) GetApisecret() (string) {
 }
 
 func (t *TurretIO) GetHTTPClient() (*http.Client) {
+	if t.httpClient != nil {
+		return t.httpClient
+	}
 	return &http.Client{}
 }
 
-func (t *TurretIO) buildPath(resourceType string, resource string) string {
-    return fmt.Sprintf("%s/latest/%s/%s", ENDPOINT, resourceType, resource)
+// GetBaseURL returns the configured base URL, or ENDPOINT if none was set
+func (t *TurretIO) GetBaseURL() string {
+	if t.baseURL == "" {
+		return ENDPOINT
+	}
+	return t.baseURL
+}
+
+// GetAPIVersion returns the configured API version, or DEFAULT_API_VERSION if none was set
+func (t *TurretIO) GetAPIVersion() string {
+	if t.apiVersion == "" {
+		return DEFAULT_API_VERSION
+	}
+	return t.apiVersion
+}
+
+// buildPath turns a resource path such as USER_RESOURCE_PATH + "/email" into a full URL
+func (t *TurretIO) buildPath(path string) string {
+	return fmt.Sprintf("%s/%s%s", t.GetBaseURL(), t.GetAPIVersion(), path)
 }
 
 func (t *TurretIO) makeSignature(url string, payload *map[string]interface {}, timestamp int64) (string, error) {
-    // cut ENDPOINT from url
-    u := strings.Replace(url, ENDPOINT, "", -1)
+	// sign only the part of the url following the base url
+	u := strings.TrimPrefix(url, t.GetBaseURL())
     j, err := json.Marshal(payload)
     if err != nil {
         return "", err
     }
 
-    stringToSign := fmt.Sprintf("%s%s%s", u, string(j), strconv.FormatInt(timestamp, 10))
-    k, err := base64.StdEncoding.DecodeString(t.Apisecret)
-    if err != nil {
-        return "", err
-    }
-    h := hmac.New(sha512.New, []byte(k))
-    h.Write([]byte(stringToSign))
-    return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+	return signRequest(t.Apisecret, u, j, timestamp)
 }
 
-func (t *TurretIO) request(url string, method string, payload *map[string]interface {}, client *http.Client) (*TurretIOResponse, error) {
+// resourcePath strips the version from paths built with the deprecated
+// *_PATH constants, so that they follow WithAPIVersion too
+func resourcePath(url string) string {
+	if strings.HasPrefix(url, "/"+DEFAULT_API_VERSION+"/") {
+		return strings.TrimPrefix(url, "/"+DEFAULT_API_VERSION)
+	}
+	return url
+}
+
+func (t *TurretIO) request(ctx context.Context, url string, method string, payload *map[string]interface{}, client *http.Client) (*TurretIOResponse, error) {
+	url = resourcePath(url)
+	call := &Call{
+		Resource:  resourceForPath(url),
+		Operation: operationFrom(ctx),
+		Method:    method,
+		Path:      url,
+		Header:    make(http.Header),
+	}
+	call.Target, call.EmailID = targetForPath(url)
+	if payload != nil {
+		call.Payload = *payload
+	}
+	send := func(ctx context.Context, call *Call) (*TurretIOResponse, error) {
+		return t.send(ctx, call, client)
+	}
+	start := time.Now()
+	resp, err := t.chain(send)(ctx, call)
+	t.logCall(ctx, call, resp, err, time.Since(start))
+	return resp, err
+}
+
+// send makes call, retrying as the RetryPolicy allows, and counts the attempts
+func (t *TurretIO) send(ctx context.Context, call *Call, client *http.Client) (*TurretIOResponse, error) {
+	idempotent := isIdempotent(ctx)
+	limiters := t.limitersFor(call.Path)
+	for attempt := 1; ; attempt++ {
+		if err := waitLimiters(ctx, limiters); err != nil {
+			return nil, err
+		}
+		call.Attempts = attempt
+		resp, err := t.attempt(ctx, call, client)
+		var apiErr *APIError
+		if err == nil {
+			observeRateLimit(limiters, resp.StatusCode, resp.Header)
+			return resp, nil
+		}
+		if errors.As(err, &apiErr) {
+			observeRateLimit(limiters, apiErr.StatusCode, apiErr.Header)
+		}
+		wait, retry := t.retryPolicy.shouldRetry(ctx, attempt, idempotent, err)
+		if !retry {
+			return nil, err
+		}
+		if err := sleepContext(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// attempt sends a single request, signed with a fresh timestamp. Retries of
+// a call get strictly increasing timestamps, so that a Verifier does not take
+// a retry made within the same second for a replay.
+func (t *TurretIO) attempt(ctx context.Context, call *Call, client *http.Client) (*TurretIOResponse, error) {
+	method, url, payload := call.Method, call.Path, &call.Payload
     // make timestamp
     timestamp := int64(time.Now().Unix())
+	if timestamp <= call.timestamp {
+		timestamp = call.timestamp + 1
+	}
+	call.timestamp = timestamp
     // sign request
-	full_url := fmt.Sprintf("%s%s", ENDPOINT, url)
+	full_url := t.buildPath(url)
     sig, err := t.makeSignature(full_url, payload, timestamp)
     if err != nil {
         return nil, err
@@ -124,14 +270,18 @@ func (t *TurretIO) request(url string, method string, payload *map[string]interf
 
     b.Write([]byte(base64.StdEncoding.EncodeToString(j)))
 
-    req, err := http.NewRequest(method, full_url, &b)
+	req, err := http.NewRequestWithContext(ctx, method, full_url, &b)
     if err != nil {
         return nil, err
     }
 
+	for k, v := range call.Header {
+		req.Header[k] = append([]string(nil), v...)
+	}
     req.Header.Set("X-Ls-Auth", sig)
     req.Header.Set("X-Ls-Time", strconv.FormatInt(timestamp, 10))
     req.Header.Set("X-Ls-Key", t.Apikey)
+	t.logAttempt(ctx, call, req.Header)
 
     response, err := client.Do(req)
 
@@ -139,36 +289,49 @@ func (t *TurretIO) request(url string, method string, payload *map[string]interf
         return nil, err
     }
 
-    //log.Print(response)
-
     defer response.Body.Close()
 
     r, err := ioutil.ReadAll(response.Body)
 	if err != nil {
+		if response.StatusCode >= 200 && response.StatusCode <= 299 {
+			return nil, &responseError{fmt.Errorf("turretIO: reading %s %s response: %w", method, url, err)}
+		}
 		return nil, err
 	}
 
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, newAPIError(method, url, response, r)
+	}
+
 	var jresponse map[string]interface{}
-	err = json.Unmarshal(r, &jresponse)
-	if err != nil {
-		if response.Status == "401 Unauthorized" {
-			// Here, err is actually "Invalid character 'U'" because of
-			// "Unauthorized" being returned in the body, so let's not send
-			// that as an actual error
-			return &TurretIOResponse{nil, response.Status}, nil
+	if len(bytes.TrimSpace(r)) > 0 {
+		if err := json.Unmarshal(r, &jresponse); err != nil {
+			return nil, fmt.Errorf("turretIO: decoding %s %s response: %w", method, url, err)
 		}
-
-		return nil, err
 	}
-    return &TurretIOResponse{jresponse, response.Status}, err
+	return &TurretIOResponse{JSONBody: jresponse, Status: response.Status, StatusCode: response.StatusCode, Header: response.Header}, nil
 }
 
+// GetRequest sends a signed GET request to url, a resource path such as
+// USER_RESOURCE_PATH + "/email". Paths built with the deprecated *_PATH
+// constants are accepted as well.
 func (t *TurretIO) GetRequest(url string, payload *map[string]interface {}, client *http.Client) (*TurretIOResponse, error) {
-	resp, err := t.request(url, "GET", payload, client)
-	return resp, err
+	return t.GetRequestContext(context.Background(), url, payload, client)
 }
 
+// PostRequest works like GetRequest with a POST request
 func (t *TurretIO) PostRequest(url string, payload *map[string]interface {}, client *http.Client) (*TurretIOResponse, error) {
-	resp, err := t.request(url, "POST", payload, client)
+	return t.PostRequestContext(context.Background(), url, payload, client)
+}
+
+// GetRequestContext sends a signed GET request through the middleware chain, aborting it when ctx is done
+func (t *TurretIO) GetRequestContext(ctx context.Context, url string, payload *map[string]interface{}, client *http.Client) (*TurretIOResponse, error) {
+	resp, err := t.request(ctx, url, "GET", payload, client)
+	return resp, err
+}
+
+// PostRequestContext sends a signed POST request through the middleware chain, aborting it when ctx is done
+func (t *TurretIO) PostRequestContext(ctx context.Context, url string, payload *map[string]interface{}, client *http.Client) (*TurretIOResponse, error) {
+	resp, err := t.request(ctx, url, "POST", payload, client)
 	return resp, err
 }
@@ -9,12 +9,17 @@ import (
 )
 
 // NewAppEngineTurretIO is used to create a new TurretIO base instance compatible
-// with Google App Engine and requires a extra context parameter
-func NewAppEngineTurretIO(api_key string, api_secret string, ctx appengine.Context) *AppEngineTurretIO {
+// with Google App Engine and requires a extra context parameter.
+// Options are applied as in NewTurretIOWithOptions, except WithHTTPClient
+// which is superseded by the urlfetch client.
+func NewAppEngineTurretIO(api_key string, api_secret string, ctx appengine.Context, opts ...Option) *AppEngineTurretIO {
     t := &AppEngineTurretIO{}
 	t.GAEContext = ctx
     t.TurretIO.Apikey = api_key
     t.TurretIO.Apisecret = api_secret
+	for _, opt := range opts {
+		opt(&t.TurretIO)
+	}
     return t
 }
 
@@ -0,0 +1,203 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const DEFAULT_BATCH_CONCURRENCY = 4
+
+// UserBatchItem is one user to upsert through a UserBatcher
+type UserBatchItem struct {
+	Email      string
+	Attributes map[string]string
+	Properties map[string]string
+}
+
+// UserBatchResult is the outcome of upserting one UserBatchItem
+type UserBatchResult struct {
+	Item   UserBatchItem
+	Record *UserRecord
+	Err    error
+}
+
+// UserBatchProgress is reported to UserBatcher.OnProgress after every item
+type UserBatchProgress struct {
+	Processed int
+	Succeeded int
+	Failed    int
+	Elapsed   time.Duration
+}
+
+// UserBatchSummary aggregates the results of UserBatcher.Run
+type UserBatchSummary struct {
+	UserBatchProgress
+	// Failures holds every failed item with its error
+	Failures []UserBatchResult
+}
+
+// UserBatcher upserts a stream of users with User.Set through a bounded
+// pool of workers
+type UserBatcher struct {
+	User *User
+	// Concurrency is the number of concurrent User.Set calls. Defaults to DEFAULT_BATCH_CONCURRENCY.
+	Concurrency int
+	// RequestsPerSecond caps the rate of User.Set calls across workers, 0 means no limit
+	RequestsPerSecond float64
+	// OnResult, when set, is called with every result. Calls are serialized.
+	OnResult func(UserBatchResult)
+	// OnProgress, when set, is called after every processed item. Calls are serialized.
+	OnProgress func(UserBatchProgress)
+}
+
+// NewUserBatcher creates a UserBatcher sending through u
+func NewUserBatcher(u *User) *UserBatcher {
+	return &UserBatcher{User: u, Concurrency: DEFAULT_BATCH_CONCURRENCY}
+}
+
+// Run upserts every item received on items until the channel is closed or
+// ctx is done. Failed items do not stop the batch; they are collected in the
+// summary. The returned error is only set when ctx ended the run before items
+// was closed and drained, in which case the items taken from items but not
+// sent are recorded as failed with ctx.Err(), so that every item taken from
+// the channel is in the summary.
+func (b *UserBatcher) Run(ctx context.Context, items <-chan UserBatchItem) (*UserBatchSummary, error) {
+	concurrency := b.Concurrency
+	if concurrency < 1 {
+		concurrency = DEFAULT_BATCH_CONCURRENCY
+	}
+
+	var limiter *RateLimiter
+	if b.RequestsPerSecond > 0 {
+		var err error
+		if limiter, err = NewRateLimiter(b.RequestsPerSecond, 1); err != nil {
+			return nil, err
+		}
+	}
+
+	start := time.Now()
+	summary := &UserBatchSummary{}
+	var mu sync.Mutex
+	record := func(result UserBatchResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		summary.Processed++
+		if result.Err != nil {
+			summary.Failed++
+			summary.Failures = append(summary.Failures, result)
+		} else {
+			summary.Succeeded++
+		}
+		summary.Elapsed = time.Since(start)
+		if b.OnResult != nil {
+			b.OnResult(result)
+		}
+		if b.OnProgress != nil {
+			b.OnProgress(summary.UserBatchProgress)
+		}
+	}
+
+	// interrupted is set when ctx stops a worker before items is drained
+	interrupted := false
+	interrupt := func(item *UserBatchItem) {
+		if item != nil {
+			record(UserBatchResult{Item: *item, Err: ctx.Err()})
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		interrupted = true
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				var item UserBatchItem
+				var ok bool
+				select {
+				case <-ctx.Done():
+					// the run is complete if items is closed and drained
+					select {
+					case item, ok = <-items:
+						if !ok {
+							return
+						}
+						interrupt(&item)
+					default:
+						interrupt(nil)
+					}
+					return
+				case item, ok = <-items:
+					if !ok {
+						return
+					}
+				}
+				// an item taken from items is always recorded, so that
+				// callers can tell which ones were not sent
+				if ctx.Err() != nil {
+					interrupt(&item)
+					return
+				}
+				if limiter != nil {
+					if err := limiter.Wait(ctx); err != nil {
+						if ctx.Err() != nil {
+							interrupt(&item)
+							return
+						}
+						// the wait would outlast the deadline of ctx
+						record(UserBatchResult{Item: item, Err: err})
+						continue
+					}
+				}
+				rec, err := b.User.SetContext(ctx, item.Email, item.Attributes, item.Properties)
+				record(UserBatchResult{Item: item, Record: rec, Err: err})
+			}
+		}()
+	}
+	wg.Wait()
+
+	summary.Elapsed = time.Since(start)
+	if interrupted {
+		return summary, ctx.Err()
+	}
+	return summary, nil
+}
+
+// RunSlice works like Run for an in-memory list of items. The returned error
+// is only set when ctx ended the run before every item was processed.
+func (b *UserBatcher) RunSlice(ctx context.Context, items []UserBatchItem) (*UserBatchSummary, error) {
+	ch := make(chan UserBatchItem)
+	go func() {
+		defer close(ch)
+		for _, item := range items {
+			select {
+			case ch <- item:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	summary, err := b.Run(ctx, ch)
+	// the producer stops on ctx too, so closing ch does not mean all items were sent
+	if err == nil && summary.Processed < len(items) {
+		err = ctx.Err()
+	}
+	return summary, err
+}
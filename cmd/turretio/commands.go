@@ -0,0 +1,736 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/turretIO/turret-io-go"
+)
+
+var commands = map[string]map[string]command{
+	"user": {
+		"get": {args: "<email>", help: "show a user", run: userGet},
+		"set": {args: "[-attr k=v]... [-prop k=v]... <email>", help: "create or update a user", run: userSet},
+		"import": {
+			args: "[-format csv|jsonl] [-email-column c] [-attr-columns a,b] [-prop-columns c,d] [-rejects f] [-checkpoint f] <file>",
+			help: "create or update the users listed in a file",
+			run:  userImport,
+			long: true,
+		},
+	},
+	"target": {
+		"get":    {args: "<target>", help: "show a target", run: targetGet},
+		"create": {args: "[-attr k=v]... [-attributes-file f] <target>", help: "create a target", run: targetCreate},
+		"update": {args: "[-attr k=v]... [-attributes-file f] <target>", help: "update a target", run: targetUpdate},
+		"sync": {
+			args: "[-apply] [-yes] <file>",
+			help: "show, or apply with -apply, the changes that bring targets in line with a JSON definition file",
+			run:  targetSync,
+			long: true,
+		},
+	},
+	"email": {
+		"get":       {args: "<target> <email_id>", help: "show a target email", run: emailGet},
+		"create":    {args: "-subject s [-html-file f] [-plain-file f] [-derive-plain] [-lint] <target>", help: "create a target email", run: emailCreate},
+		"update":    {args: "-subject s [-html-file f] [-plain-file f] [-derive-plain] [-lint] <target> <email_id>", help: "update a target email", run: emailUpdate},
+		"send":      {args: "-from addr <target> <email_id>", help: "send a target email to its target", run: emailSend},
+		"send-test": {args: "-from addr -to addr <target> <email_id>", help: "send a test of a target email", run: emailSendTest},
+		"lint": {
+			args:  "-subject s [-html-file f] [-plain-file f] [-derive-plain]",
+			help:  "check email content for deliverability problems, failing on errors",
+			run:   emailLint,
+			local: true,
+		},
+		"sync": {
+			args: "[-apply] [-derive-plain] [-lint] <dir>",
+			help: "show, or apply with -apply, the updates that bring target emails in line with <dir>/<target>/<email_id>/",
+			run:  emailSync,
+			long: true,
+		},
+		"preview": {
+			args:  "-subject s [-html-file f] [-plain-file f] [-derive-plain] [-email addr] [-prop k=v]... [-known p,q]",
+			help:  "render email content locally for a sample user",
+			run:   emailPreview,
+			local: true,
+		},
+	},
+	"account": {
+		"get": {args: "", help: "show the account", run: accountGet},
+		"set": {args: "[-opt k=v]... <turret.io|aws|smtp>", help: "set the outgoing method", run: accountSet},
+	},
+}
+
+// kvFlag collects repeated k=v flags, in order
+type kvFlag struct {
+	keys   []string
+	values map[string]string
+}
+
+func (f *kvFlag) String() string {
+	pairs := make([]string, len(f.keys))
+	for i, k := range f.keys {
+		pairs[i] = k + "=" + f.values[k]
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f *kvFlag) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("expected k=v, got %q", s)
+	}
+	if f.values == nil {
+		f.values = make(map[string]string)
+	}
+	if _, seen := f.values[k]; !seen {
+		f.keys = append(f.keys, k)
+	}
+	f.values[k] = v
+	return nil
+}
+
+// parseArgs parses flags placed before, between or after positional
+// arguments and checks the number of positional arguments
+func parseArgs(fs *flag.FlagSet, args []string, nargs int) ([]string, error) {
+	fs.SetOutput(io.Discard)
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, usagef("%s", err)
+		}
+		if terminated(fs, args) {
+			// every argument after -- is positional
+			positional = append(positional, fs.Args()...)
+			break
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(positional) != nargs {
+		return nil, usagef("expected %d argument(s), got %d", nargs, len(positional))
+	}
+	return positional, nil
+}
+
+// terminated reports whether fs.Parse(args) stopped at a -- terminator, as
+// opposed to a -- given as the value of a flag
+func terminated(fs *flag.FlagSet, args []string) bool {
+	parsed := len(args) - fs.NArg()
+	if parsed == 0 || args[parsed-1] != "--" {
+		return false
+	}
+	if parsed == 1 {
+		return true
+	}
+	prev := args[parsed-2]
+	if !strings.HasPrefix(prev, "-") || strings.Contains(prev, "=") {
+		return true
+	}
+	f := fs.Lookup(strings.TrimLeft(prev, "-"))
+	if f == nil {
+		return true
+	}
+	boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && boolFlag.IsBoolFlag()
+}
+
+// readContent returns the content of path, or of stdin when path is "-"
+func readContent(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	if path == "-" {
+		b, err := io.ReadAll(os.Stdin)
+		return string(b), err
+	}
+	b, err := os.ReadFile(path)
+	return string(b), err
+}
+
+func userGet(e *env, args []string) error {
+	pos, err := parseArgs(flag.NewFlagSet("user get", flag.ContinueOnError), args, 1)
+	if err != nil {
+		return err
+	}
+	u, err := turretIO.NewUser(e.turret).GetContext(e.ctx, pos[0])
+	if err != nil {
+		return err
+	}
+	return e.out.print(u.Raw)
+}
+
+func userSet(e *env, args []string) error {
+	fs := flag.NewFlagSet("user set", flag.ContinueOnError)
+	var attrs, props kvFlag
+	fs.Var(&attrs, "attr", "attribute `k=v`, repeatable")
+	fs.Var(&props, "prop", "property `k=v`, repeatable")
+	pos, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	u, err := turretIO.NewUser(e.turret).SetContext(e.ctx, pos[0], attrs.values, props.values)
+	if err != nil {
+		return err
+	}
+	return e.out.print(u.Raw)
+}
+
+// splitColumns splits a comma separated list of column names
+func splitColumns(s string) []string {
+	var columns []string
+	for _, c := range strings.Split(s, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			columns = append(columns, c)
+		}
+	}
+	return columns
+}
+
+func userImport(e *env, args []string) error {
+	fs := flag.NewFlagSet("user import", flag.ContinueOnError)
+	format := fs.String("format", "", "input format, csv or jsonl (default from the file extension)")
+	emailColumn := fs.String("email-column", turretIO.DEFAULT_EMAIL_COLUMN, "CSV column holding the email")
+	attrColumns := fs.String("attr-columns", "", "comma separated CSV columns sent as attributes (default all but email and properties)")
+	propColumns := fs.String("prop-columns", "", "comma separated CSV columns sent as properties")
+	rejectsPath := fs.String("rejects", "", "file receiving rejected rows (default <file>.rejects)")
+	checkpoint := fs.String("checkpoint", "", "checkpoint file used to resume an interrupted import (default <file>.checkpoint)")
+	pos, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	path := pos[0]
+	if *format == "" {
+		*format = "csv"
+		if ext := strings.ToLower(filepath.Ext(path)); ext == ".jsonl" || ext == ".ndjson" {
+			*format = "jsonl"
+		}
+	}
+	if *format != "csv" && *format != "jsonl" {
+		return usagef("unknown format %q", *format)
+	}
+	if *rejectsPath == "" {
+		*rejectsPath = path + ".rejects"
+	}
+	if *checkpoint == "" {
+		*checkpoint = path + ".checkpoint"
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	// keep the rejects of the interrupted run when resuming
+	mode := os.O_TRUNC
+	if _, err := os.Stat(*checkpoint); err == nil {
+		mode = os.O_APPEND
+	}
+	rejects, err := os.OpenFile(*rejectsPath, os.O_CREATE|os.O_WRONLY|mode, 0644)
+	if err != nil {
+		return err
+	}
+	defer rejects.Close()
+
+	im := turretIO.NewUserImporter(turretIO.NewUser(e.turret))
+	im.Mapping = turretIO.ColumnMapping{Email: *emailColumn, Attributes: splitColumns(*attrColumns), Properties: splitColumns(*propColumns)}
+	im.Rejects = rejects
+	// the rejects of the interrupted run already start with the CSV header
+	if info, err := rejects.Stat(); err == nil && info.Size() > 0 {
+		im.OmitRejectsHeader = true
+	}
+	im.CheckpointPath = *checkpoint
+	im.OnRow = func(row int, err error) {
+		if err != nil {
+			fmt.Fprintf(e.stderr, "row %d: %s\n", row, err)
+		}
+	}
+
+	var summary *turretIO.ImportSummary
+	if *format == "jsonl" {
+		summary, err = im.ImportJSONL(e.ctx, in)
+	} else {
+		summary, err = im.ImportCSV(e.ctx, in)
+	}
+	if summary != nil {
+		if perr := e.out.print(map[string]interface{}{
+			"imported": summary.Imported,
+			"rejected": summary.Rejected,
+			"skipped":  summary.Skipped,
+		}); perr != nil && err == nil {
+			err = perr
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%w (run the same command again to resume)", err)
+	}
+	// the import is complete, a new run of the same file starts over
+	return os.Remove(*checkpoint)
+}
+
+func targetGet(e *env, args []string) error {
+	pos, err := parseArgs(flag.NewFlagSet("target get", flag.ContinueOnError), args, 1)
+	if err != nil {
+		return err
+	}
+	t, err := turretIO.NewTarget(e.turret).GetContext(e.ctx, pos[0])
+	if err != nil {
+		return err
+	}
+	return e.out.print(t.Raw)
+}
+
+// targetAttributes reads the attribute list of target create and update, either
+// as a JSON list from -attributes-file or as one {k: v} entry per -attr flag
+func targetAttributes(fs *flag.FlagSet, args []string) (string, []map[string]interface{}, error) {
+	var attrs kvFlag
+	fs.Var(&attrs, "attr", "attribute `k=v` the target matches, repeatable")
+	file := fs.String("attributes-file", "", "JSON attribute list, - for stdin")
+	pos, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var list []map[string]interface{}
+	if *file != "" {
+		data, err := readContent(*file)
+		if err != nil {
+			return "", nil, err
+		}
+		if err := json.Unmarshal([]byte(data), &list); err != nil {
+			return "", nil, fmt.Errorf("reading %s: %w", *file, err)
+		}
+	}
+	for _, k := range attrs.keys {
+		list = append(list, map[string]interface{}{k: attrs.values[k]})
+	}
+	if len(list) == 0 {
+		return "", nil, usagef("no attributes given")
+	}
+	return pos[0], list, nil
+}
+
+func targetCreate(e *env, args []string) error {
+	name, list, err := targetAttributes(flag.NewFlagSet("target create", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+	t, err := turretIO.NewTarget(e.turret).CreateContext(e.ctx, name, list)
+	if err != nil {
+		return err
+	}
+	return e.out.print(t.Raw)
+}
+
+func targetUpdate(e *env, args []string) error {
+	name, list, err := targetAttributes(flag.NewFlagSet("target update", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+	t, err := turretIO.NewTarget(e.turret).UpdateContext(e.ctx, name, list)
+	if err != nil {
+		return err
+	}
+	return e.out.print(t.Raw)
+}
+
+func targetSync(e *env, args []string) error {
+	fs := flag.NewFlagSet("target sync", flag.ContinueOnError)
+	apply := fs.Bool("apply", false, "create and update the targets, without it only the plan is shown")
+	yes := fs.Bool("yes", false, "apply destructive changes without asking")
+	pos, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	data, err := readContent(pos[0])
+	if err != nil {
+		return err
+	}
+	defs, err := turretIO.LoadTargetDefinitions(strings.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	sync := turretIO.NewTargetSync(turretIO.NewTarget(e.turret))
+	plan, err := sync.PlanContext(e.ctx, defs)
+	if err != nil {
+		return err
+	}
+	if err := printPlan(e, plan.String(), targetPlanBody(plan)); err != nil {
+		return err
+	}
+	if !*apply {
+		return nil
+	}
+	allow := *yes
+	if n := len(plan.Destructive()); n > 0 && !allow {
+		if allow, err = confirm(e, fmt.Sprintf("%d existing target(s) will change, apply?", n)); err != nil {
+			return err
+		}
+	}
+	applied, err := sync.ApplyContext(e.ctx, plan, allow)
+	fmt.Fprintf(e.stderr, "%d target(s) created or updated\n", len(applied))
+	if errors.Is(err, turretIO.ErrDestructiveChange) {
+		return fmt.Errorf("%w, run again with -yes to apply them", err)
+	}
+	return err
+}
+
+// confirm asks question on the terminal, answering no when stdin is not one
+func confirm(e *env, question string) (bool, error) {
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false, nil
+	}
+	fmt.Fprintf(e.stderr, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if errors.Is(err, io.EOF) {
+		fmt.Fprintln(e.stderr)
+	} else if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+func targetPlanBody(plan *turretIO.TargetPlan) map[string]interface{} {
+	rules := func(list []turretIO.AttributeRule) []interface{} {
+		out := make([]interface{}, len(list))
+		for i, r := range list {
+			out[i] = r.String()
+		}
+		return out
+	}
+	changes := make([]interface{}, len(plan.Changes))
+	for i, c := range plan.Changes {
+		changes[i] = map[string]interface{}{
+			"name":        c.Definition.Name,
+			"action":      c.Action,
+			"destructive": c.Destructive(),
+			"removed":     rules(c.Removed),
+			"added":       rules(c.Added),
+		}
+	}
+	return map[string]interface{}{"changes": changes}
+}
+
+func emailGet(e *env, args []string) error {
+	pos, err := parseArgs(flag.NewFlagSet("email get", flag.ContinueOnError), args, 2)
+	if err != nil {
+		return err
+	}
+	te, err := turretIO.NewTargetEmail(e.turret).GetContext(e.ctx, pos[0], pos[1])
+	if err != nil {
+		return err
+	}
+	return e.out.print(te.Raw)
+}
+
+// emailContent reads the flags shared by email create and update
+type emailContent struct {
+	subject     *string
+	htmlFile    *string
+	plainFile   *string
+	derivePlain *bool
+	lint        *bool
+}
+
+func emailContentFlags(fs *flag.FlagSet) *emailContent {
+	return &emailContent{
+		subject:     fs.String("subject", "", "email subject"),
+		htmlFile:    fs.String("html-file", "", "file holding the HTML body, - for stdin"),
+		plainFile:   fs.String("plain-file", "", "file holding the plain text body, - for stdin"),
+		derivePlain: fs.Bool("derive-plain", false, "derive the plain text body from the HTML body when no -plain-file is given"),
+		lint:        fs.Bool("lint", false, "refuse content with lint errors"),
+	}
+}
+
+// targetEmail returns the TargetEmail used by email create and update
+func (c *emailContent) targetEmail(e *env) *turretIO.TargetEmail {
+	var opts []turretIO.TargetEmailOption
+	if *c.derivePlain {
+		opts = append(opts, turretIO.WithDerivedPlain())
+	}
+	if *c.lint {
+		opts = append(opts, turretIO.WithLint(turretIO.NewLinter()))
+	}
+	return turretIO.NewTargetEmail(e.turret, opts...)
+}
+
+func (c *emailContent) read() (string, string, string, error) {
+	if *c.subject == "" {
+		return "", "", "", usagef("-subject is required")
+	}
+	html, err := readContent(*c.htmlFile)
+	if err != nil {
+		return "", "", "", err
+	}
+	plain, err := readContent(*c.plainFile)
+	if err != nil {
+		return "", "", "", err
+	}
+	return *c.subject, html, plain, nil
+}
+
+func emailCreate(e *env, args []string) error {
+	fs := flag.NewFlagSet("email create", flag.ContinueOnError)
+	content := emailContentFlags(fs)
+	pos, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	subject, html, plain, err := content.read()
+	if err != nil {
+		return err
+	}
+	te, err := content.targetEmail(e).CreateContext(e.ctx, pos[0], subject, html, plain)
+	if err != nil {
+		return err
+	}
+	return e.out.print(te.Raw)
+}
+
+func emailUpdate(e *env, args []string) error {
+	fs := flag.NewFlagSet("email update", flag.ContinueOnError)
+	content := emailContentFlags(fs)
+	pos, err := parseArgs(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	subject, html, plain, err := content.read()
+	if err != nil {
+		return err
+	}
+	te, err := content.targetEmail(e).UpdateContext(e.ctx, pos[0], pos[1], subject, html, plain)
+	if err != nil {
+		return err
+	}
+	return e.out.print(te.Raw)
+}
+
+func emailSend(e *env, args []string) error {
+	fs := flag.NewFlagSet("email send", flag.ContinueOnError)
+	from := fs.String("from", "", "verified sender address")
+	pos, err := parseArgs(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	if *from == "" {
+		return usagef("-from is required")
+	}
+	resp, err := turretIO.NewTargetEmail(e.turret).SendContext(e.ctx, pos[0], pos[1], *from)
+	if err != nil {
+		return err
+	}
+	return e.out.print(resp.JSONBody)
+}
+
+func emailSendTest(e *env, args []string) error {
+	fs := flag.NewFlagSet("email send-test", flag.ContinueOnError)
+	from := fs.String("from", "", "verified sender address")
+	to := fs.String("to", "", "recipient of the test email")
+	pos, err := parseArgs(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	if *from == "" || *to == "" {
+		return usagef("-from and -to are required")
+	}
+	resp, err := turretIO.NewTargetEmail(e.turret).SendTestContext(e.ctx, pos[0], pos[1], *from, *to)
+	if err != nil {
+		return err
+	}
+	return e.out.print(resp.JSONBody)
+}
+
+func emailPreview(e *env, args []string) error {
+	fs := flag.NewFlagSet("email preview", flag.ContinueOnError)
+	content := emailContentFlags(fs)
+	email := fs.String("email", "", "email address of the sample user")
+	known := fs.String("known", "", "comma separated properties users may have (default any)")
+	var props kvFlag
+	fs.Var(&props, "prop", "sample user property `k=v`, repeatable")
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	subject, html, plain, err := content.read()
+	if err != nil {
+		return err
+	}
+
+	if *content.derivePlain && plain == "" {
+		plain = turretIO.HTMLToText(html)
+	}
+	r := turretIO.NewRenderer(splitColumns(*known)...)
+	result := r.Render(turretIO.EmailContent{Subject: subject, HTML: html, Plain: plain}, *email, props.values)
+	problems := make([]interface{}, len(result.Problems))
+	for i, p := range result.Problems {
+		problems[i] = map[string]interface{}{"field": p.Field, "offset": p.Offset, "text": p.Text, "kind": p.Kind}
+	}
+	if err := e.out.print(map[string]interface{}{
+		"subject":  result.Subject,
+		"html":     result.HTML,
+		"plain":    result.Plain,
+		"problems": problems,
+	}); err != nil {
+		return err
+	}
+	return result.Err()
+}
+
+func emailLint(e *env, args []string) error {
+	fs := flag.NewFlagSet("email lint", flag.ContinueOnError)
+	content := emailContentFlags(fs)
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	subject, html, plain, err := content.read()
+	if err != nil {
+		return err
+	}
+	if *content.derivePlain && plain == "" {
+		plain = turretIO.HTMLToText(html)
+	}
+
+	issues := turretIO.Lint(turretIO.EmailContent{Subject: subject, HTML: html, Plain: plain})
+	list := make([]interface{}, len(issues))
+	for i, issue := range issues {
+		list[i] = map[string]interface{}{
+			"rule":     issue.Rule,
+			"severity": issue.Severity,
+			"field":    issue.Field,
+			"offset":   issue.Offset,
+			"message":  issue.Message,
+		}
+	}
+	if err := e.out.print(map[string]interface{}{"issues": list}); err != nil {
+		return err
+	}
+	if errs := issues.Errors(); len(errs) > 0 {
+		return fmt.Errorf("%d lint error(s)", len(errs))
+	}
+	return nil
+}
+
+func emailSync(e *env, args []string) error {
+	fs := flag.NewFlagSet("email sync", flag.ContinueOnError)
+	apply := fs.Bool("apply", false, "update the changed emails, without it only the plan is shown")
+	derivePlain := fs.Bool("derive-plain", false, "derive missing plain text bodies from the HTML bodies")
+	lint := fs.Bool("lint", false, "refuse content with lint errors")
+	pos, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	defs, err := turretIO.LoadEmailDefinitions(os.DirFS(pos[0]))
+	if err != nil {
+		return err
+	}
+
+	var opts []turretIO.TargetEmailOption
+	if *derivePlain {
+		opts = append(opts, turretIO.WithDerivedPlain())
+	}
+	if *lint {
+		opts = append(opts, turretIO.WithLint(turretIO.NewLinter()))
+	}
+	sync := turretIO.NewEmailSync(turretIO.NewTargetEmail(e.turret, opts...))
+	plan, err := sync.PlanContext(e.ctx, defs)
+	if err != nil {
+		return err
+	}
+	if err := printPlan(e, plan.String(), emailPlanBody(plan)); err != nil {
+		return err
+	}
+	if !*apply {
+		return nil
+	}
+	updated, err := sync.ApplyContext(e.ctx, plan)
+	fmt.Fprintf(e.stderr, "%d email(s) updated\n", len(updated))
+	return err
+}
+
+// printPlan writes the human readable plan for table output and body otherwise
+func printPlan(e *env, text string, body map[string]interface{}) error {
+	if e.out.format == OUTPUT_TABLE {
+		_, err := io.WriteString(e.stdout, text)
+		return err
+	}
+	return e.out.print(body)
+}
+
+func emailPlanBody(plan *turretIO.EmailSyncPlan) map[string]interface{} {
+	changes := make([]interface{}, len(plan.Changes))
+	for i, c := range plan.Changes {
+		fields := make([]interface{}, len(c.Fields))
+		for j, f := range c.Fields {
+			fields[j] = f
+		}
+		changes[i] = map[string]interface{}{
+			"target": c.Definition.Target,
+			"id":     c.Definition.ID,
+			"action": c.Action,
+			"fields": fields,
+		}
+	}
+	return map[string]interface{}{"changes": changes}
+}
+
+func accountGet(e *env, args []string) error {
+	if _, err := parseArgs(flag.NewFlagSet("account get", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+	a, err := turretIO.NewAccount(e.turret).GetContext(e.ctx)
+	if err != nil {
+		return err
+	}
+	return e.out.print(a.Raw)
+}
+
+func accountSet(e *env, args []string) error {
+	fs := flag.NewFlagSet("account set", flag.ContinueOnError)
+	var opts kvFlag
+	fs.Var(&opts, "opt", "outgoing method option `k=v`, e.g. smtp_host=mail.example.com, repeatable")
+	pos, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	var options map[string]interface{}
+	if len(opts.keys) > 0 {
+		options = make(map[string]interface{}, len(opts.keys))
+		for k, v := range opts.values {
+			options[k] = v
+		}
+	}
+	method, err := turretIO.ParseOutgoingMethod(pos[0], options)
+	if err != nil {
+		return err
+	}
+	a, err := turretIO.NewAccount(e.turret).SetContext(e.ctx, method)
+	if err != nil {
+		return err
+	}
+	return e.out.print(a.Raw)
+}
@@ -0,0 +1,84 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const CONFIG_FILE_NAME = ".turretio.json"
+
+// config holds the credentials and endpoint used to build the client.
+// Values are read from the config file, then overridden by the environment,
+// then by command line flags.
+type config struct {
+	APIKey     string `json:"api_key"`
+	APISecret  string `json:"api_secret"`
+	BaseURL    string `json:"base_url"`
+	APIVersion string `json:"api_version"`
+}
+
+// defaultConfigPath returns ~/.turretio.json, or "" if there is no home directory
+func defaultConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, CONFIG_FILE_NAME)
+}
+
+// loadConfig reads path, falling back to the default path when empty. A
+// missing default file is not an error, a missing explicit one is.
+func loadConfig(path string) (*config, error) {
+	c := &config{}
+	explicit := path != ""
+	if !explicit {
+		path = defaultConfigPath()
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			if err := json.Unmarshal(data, c); err != nil {
+				return nil, fmt.Errorf("reading %s: %w", path, err)
+			}
+		case explicit || !errors.Is(err, os.ErrNotExist):
+			return nil, err
+		}
+	}
+
+	overrideFromEnv(&c.APIKey, "TURRETIO_API_KEY")
+	overrideFromEnv(&c.APISecret, "TURRETIO_API_SECRET")
+	overrideFromEnv(&c.BaseURL, "TURRETIO_BASE_URL")
+	overrideFromEnv(&c.APIVersion, "TURRETIO_API_VERSION")
+	return c, nil
+}
+
+func overrideFromEnv(field *string, name string) {
+	if v := os.Getenv(name); v != "" {
+		*field = v
+	}
+}
+
+func (c *config) validate() error {
+	if c.APIKey == "" || c.APISecret == "" {
+		return fmt.Errorf("missing credentials: set TURRETIO_API_KEY and TURRETIO_API_SECRET, use -key and -secret-file, or add api_key and api_secret to ~/%s", CONFIG_FILE_NAME)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command turretio calls the Turret.IO API from the command line.
+//
+// Usage:
+//
+//	turretio [global flags] <resource> <command> [flags] [args]
+//
+// Credentials are read from ~/.turretio.json (or the file given with
+// -config), then from TURRETIO_API_KEY, TURRETIO_API_SECRET,
+// TURRETIO_BASE_URL and TURRETIO_API_VERSION, then from the global flags.
+// The API secret is read from a file with -secret-file rather than given as a
+// flag, which would show it in the process list. Arguments following -- are
+// never read as flags. Run turretio -h for the list of commands.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/turretIO/turret-io-go"
+)
+
+// env is what every command runs with
+type env struct {
+	ctx    context.Context
+	turret *turretIO.TurretIO
+	out    *printer
+	stdout io.Writer
+	stderr io.Writer
+}
+
+type command struct {
+	args  string
+	help  string
+	run   func(e *env, args []string) error
+	local bool // runs without credentials
+	long  bool // not bound by -timeout, each call still is
+}
+
+// usageError is returned by commands invoked with the wrong arguments
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func usagef(format string, a ...interface{}) error {
+	return &usageError{fmt.Sprintf(format, a...)}
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+func run(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("turretio", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", "", "config file (default ~/"+CONFIG_FILE_NAME+")")
+	key := fs.String("key", "", "API key")
+	secretFile := fs.String("secret-file", "", "file holding the API secret, - for stdin")
+	baseURL := fs.String("base-url", "", "API base URL (default "+turretIO.ENDPOINT+")")
+	apiVersion := fs.String("api-version", "", "API version (default "+turretIO.DEFAULT_API_VERSION+")")
+	output := fs.String("output", OUTPUT_JSON, "output format: json or table")
+	timeout := fs.Duration("timeout", 30*time.Second, "timeout for the whole command, 0 for none")
+	retries := fs.Int("retries", 0, "retry failed calls up to this many times")
+	verbose := fs.Bool("v", false, "log API calls to stderr, with credentials redacted")
+	fs.Usage = func() { printUsage(fs) }
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if *output != OUTPUT_JSON && *output != OUTPUT_TABLE {
+		fmt.Fprintf(stderr, "turretio: unknown output format %q\n", *output)
+		return 2
+	}
+
+	if fs.NArg() < 2 {
+		printUsage(fs)
+		return 2
+	}
+	cmd, ok := commands[fs.Arg(0)][fs.Arg(1)]
+	if !ok {
+		fmt.Fprintf(stderr, "turretio: unknown command %q\n", strings.Join(fs.Args()[:2], " "))
+		return 2
+	}
+
+	e := &env{ctx: ctx, out: &printer{w: stdout, format: *output}, stdout: stdout, stderr: stderr}
+	if !cmd.local {
+		c, err := loadConfig(*configPath)
+		if err != nil {
+			fmt.Fprintf(stderr, "turretio: %s\n", err)
+			return 1
+		}
+		overrideFromFlag(&c.APIKey, *key)
+		if *secretFile != "" {
+			secret, err := readContent(*secretFile)
+			if err != nil {
+				fmt.Fprintf(stderr, "turretio: %s\n", err)
+				return 1
+			}
+			overrideFromFlag(&c.APISecret, strings.TrimSpace(secret))
+		}
+		overrideFromFlag(&c.BaseURL, *baseURL)
+		overrideFromFlag(&c.APIVersion, *apiVersion)
+		if err := c.validate(); err != nil {
+			fmt.Fprintf(stderr, "turretio: %s\n", err)
+			return 1
+		}
+
+		var opts []turretIO.Option
+		if c.BaseURL != "" {
+			opts = append(opts, turretIO.WithBaseURL(c.BaseURL))
+		}
+		if c.APIVersion != "" {
+			opts = append(opts, turretIO.WithAPIVersion(c.APIVersion))
+		}
+		if *retries > 0 {
+			policy := turretIO.DefaultRetryPolicy()
+			policy.MaxAttempts = *retries + 1
+			opts = append(opts, turretIO.WithRetryPolicy(policy))
+		}
+		if *verbose {
+			opts = append(opts, turretIO.WithLogger(slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+		}
+		e.turret = turretIO.NewTurretIOWithOptions(c.APIKey, c.APISecret, opts...)
+	}
+
+	if *timeout > 0 && !cmd.long {
+		var cancel context.CancelFunc
+		e.ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	if err := cmd.run(e, fs.Args()[2:]); err != nil {
+		var uerr *usageError
+		if errors.As(err, &uerr) {
+			fmt.Fprintf(stderr, "turretio: %s\nusage: turretio %s %s %s\n", err, fs.Arg(0), fs.Arg(1), cmd.args)
+			return 2
+		}
+		fmt.Fprintf(stderr, "turretio: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+func overrideFromFlag(field *string, value string) {
+	if value != "" {
+		*field = value
+	}
+}
+
+func printUsage(fs *flag.FlagSet) {
+	w := fs.Output()
+	fmt.Fprintf(w, "usage: turretio [global flags] <resource> <command> [flags] [args]\n\ncommands:\n")
+	resources := make([]string, 0, len(commands))
+	for r := range commands {
+		resources = append(resources, r)
+	}
+	sort.Strings(resources)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, r := range resources {
+		names := make([]string, 0, len(commands[r]))
+		for n := range commands[r] {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			fmt.Fprintf(tw, "  %s %s %s\t%s\n", r, n, commands[r][n].args, commands[r][n].help)
+		}
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\nglobal flags:\n")
+	fs.PrintDefaults()
+}
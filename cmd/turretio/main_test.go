@@ -0,0 +1,256 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/turretIO/turret-io-go/turretiotest"
+)
+
+const VALID_API_KEY = "dmFsaWQ="
+const VALID_API_SECRET = "c2VjcmV0"
+const EMAIL_TEST = "test@example.com"
+
+// cliEnv isolates a test from the credentials of the user running it and
+// returns a fake server preloaded with a user and a target email
+func cliEnv(t *testing.T) *turretiotest.Server {
+	t.Setenv("HOME", t.TempDir())
+	for _, name := range []string{"TURRETIO_API_KEY", "TURRETIO_API_SECRET", "TURRETIO_BASE_URL", "TURRETIO_API_VERSION"} {
+		t.Setenv(name, "")
+	}
+	srv := turretiotest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.AddCredentials(VALID_API_KEY, VALID_API_SECRET)
+	srv.SetTargetEmail("eastwest", "abc", "Hello", "<p>Hi</p>", "Hi")
+	return srv
+}
+
+func runCLI(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRun(t *testing.T) {
+	srv := cliEnv(t)
+	creds := []string{"-key", VALID_API_KEY, "-secret-file", writeFile(t, "secret", VALID_API_SECRET+"\n"), "-base-url", srv.URL}
+	html := writeFile(t, "body.html", `<p>Hi <a href="https://example.com/unsubscribe">unsubscribe</a></p>`)
+	badHTML := writeFile(t, "bad.html", `<p>Hi <a href="/unsubscribe">unsubscribe</a>`)
+
+	tests := []struct {
+		name   string
+		args   []string
+		code   int
+		stdout string
+		stderr string
+	}{
+		{"no arguments", nil, 2, "", "usage: turretio"},
+		{"help", []string{"-h"}, 0, "", "usage: turretio"},
+		{"unknown global flag", []string{"-bogus", "user", "get"}, 2, "", "flag provided but not defined"},
+		{"unknown command", []string{"user", "delete", EMAIL_TEST}, 2, "", `unknown command "user delete"`},
+		{"unknown output", []string{"-output", "xml", "user", "get", EMAIL_TEST}, 2, "", `unknown output format "xml"`},
+		{"missing credentials", []string{"user", "get", EMAIL_TEST}, 1, "", "missing credentials"},
+		{"wrong argument count", append(creds, "user", "get"), 2, "", "usage: turretio user get <email>"},
+		{"bad k=v flag", append(creds, "user", "set", "-attr", "location", EMAIL_TEST), 2, "", "expected k=v"},
+		{"set", append(creds, "user", "set", "-attr", "location=midwest", EMAIL_TEST), 0, `"location": "midwest"`, ""},
+		{"flags after arguments", append(creds, "user", "set", EMAIL_TEST, "-prop", "name=john"), 0, `"name": "john"`, ""},
+		{"get json", append(creds, "user", "get", EMAIL_TEST), 0, `"email": "test@example.com"`, ""},
+		{"get table", append(creds, "-output", "table", "user", "get", EMAIL_TEST), 0, "FIELD", ""},
+		{"not found", append(creds, "user", "get", "nobody@example.com"), 1, "", "404"},
+		{"wrong secret", []string{"-key", VALID_API_KEY, "-secret-file", writeFile(t, "wrong", "d3Jvbmc="), "-base-url", srv.URL, "account", "get"}, 1, "", "401"},
+		{"secret flag", []string{"-key", VALID_API_KEY, "-secret", VALID_API_SECRET, "account", "get"}, 2, "", "flag provided but not defined: -secret"},
+		{"missing secret file", []string{"-key", VALID_API_KEY, "-secret-file", filepath.Join(t.TempDir(), "missing"), "account", "get"}, 1, "", "no such file"},
+		{"flags after --", append(creds, "email", "get", "--", "eastwest", "-v"), 1, "", "404"},
+		{"email get", append(creds, "email", "get", "eastwest", "abc"), 0, `"subject": "Hello"`, ""},
+		{"lint without credentials", []string{"email", "lint", "-subject", "Hello", "-html-file", html}, 0, `"issues"`, ""},
+		{"lint errors", []string{"email", "lint", "-subject", "Hello", "-html-file", badHTML}, 1, "relative", "lint error(s)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, stdout, stderr := runCLI(tt.args...)
+			if code != tt.code {
+				t.Errorf("exit code %d, want %d\nstdout: %s\nstderr: %s", code, tt.code, stdout, stderr)
+			}
+			if !strings.Contains(stdout, tt.stdout) {
+				t.Errorf("stdout should contain %q, got %s", tt.stdout, stdout)
+			}
+			if !strings.Contains(stderr, tt.stderr) {
+				t.Errorf("stderr should contain %q, got %s", tt.stderr, stderr)
+			}
+		})
+	}
+
+	if u := srv.User(EMAIL_TEST); u == nil {
+		t.Errorf("user set should have stored the user")
+	}
+}
+
+func TestUserImportResume(t *testing.T) {
+	srv := cliEnv(t)
+	path := writeFile(t, "users.csv", "email,location\nnot-an-email,midwest\nbad-too,eastwest\none@example.com,midwest\n")
+	// an interrupted run completed the first row and rejected it
+	if err := os.WriteFile(path+".checkpoint", []byte("1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+".rejects", []byte("email,location,error\nnot-an-email,midwest,invalid\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	code, stdout, stderr := runCLI("-key", VALID_API_KEY, "-secret-file", writeFile(t, "secret", VALID_API_SECRET), "-base-url", srv.URL, "user", "import", path)
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, `"skipped": 1`) || !strings.Contains(stdout, `"imported": 1`) {
+		t.Errorf("unexpected summary %s", stdout)
+	}
+	rejects, err := os.ReadFile(path + ".rejects")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(rejects), "email,location,error"); n != 1 {
+		t.Errorf("resumed import should append to the rejects without a new header, got %q", rejects)
+	}
+	if !strings.Contains(string(rejects), "not-an-email") || !strings.Contains(string(rejects), "bad-too") {
+		t.Errorf("rejects of both runs should be kept, got %q", rejects)
+	}
+	if _, err := os.Stat(path + ".checkpoint"); !os.IsNotExist(err) {
+		t.Errorf("completed import should remove the checkpoint")
+	}
+}
+
+func TestRunTableOutput(t *testing.T) {
+	srv := cliEnv(t)
+	code, stdout, stderr := runCLI("-key", VALID_API_KEY, "-secret-file", writeFile(t, "secret", VALID_API_SECRET), "-base-url", srv.URL,
+		"-output", "table", "email", "get", "eastwest", "abc")
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if !strings.HasPrefix(lines[0], "FIELD") {
+		t.Errorf("table should start with a header, got %q", lines[0])
+	}
+	found := false
+	for _, l := range lines[1:] {
+		if f := strings.Fields(l); len(f) == 2 && f[0] == "subject" && f[1] == "Hello" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("table should have a subject row, got\n%s", stdout)
+	}
+}
+
+func TestRunJSONOutput(t *testing.T) {
+	srv := cliEnv(t)
+	code, stdout, stderr := runCLI("-key", VALID_API_KEY, "-secret-file", writeFile(t, "secret", VALID_API_SECRET), "-base-url", srv.URL, "account", "get")
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(stdout), &body); err != nil {
+		t.Fatalf("output is not JSON: %s\n%s", err, stdout)
+	}
+	if _, ok := body["outgoing_method"]; !ok {
+		t.Errorf("unexpected account %v", body)
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	srv := cliEnv(t)
+	write := func(c map[string]string) string {
+		data, _ := json.Marshal(c)
+		return writeFile(t, "config.json", string(data))
+	}
+
+	tests := []struct {
+		name   string
+		config map[string]string
+		env    map[string]string
+		flags  []string
+		code   int
+		stderr string
+	}{
+		{
+			name:   "config file",
+			config: map[string]string{"api_key": VALID_API_KEY, "api_secret": VALID_API_SECRET, "base_url": srv.URL},
+			code:   0,
+		},
+		{
+			name:   "environment overrides config file",
+			config: map[string]string{"api_key": "d3Jvbmc=", "api_secret": "d3Jvbmc=", "base_url": srv.URL},
+			env:    map[string]string{"TURRETIO_API_KEY": VALID_API_KEY, "TURRETIO_API_SECRET": VALID_API_SECRET},
+			code:   0,
+		},
+		{
+			name:   "flags override environment",
+			config: map[string]string{"base_url": srv.URL},
+			env:    map[string]string{"TURRETIO_API_KEY": VALID_API_KEY, "TURRETIO_API_SECRET": VALID_API_SECRET},
+			flags:  []string{"-secret-file", writeFile(t, "wrong", "d3Jvbmc=")},
+			code:   1,
+			stderr: "401",
+		},
+		{
+			name:  "flags only",
+			env:   map[string]string{"TURRETIO_BASE_URL": srv.URL},
+			flags: []string{"-key", VALID_API_KEY, "-secret-file", writeFile(t, "secret", VALID_API_SECRET)},
+			code:  0,
+		},
+		{
+			name:   "unsupported API version from environment",
+			config: map[string]string{"api_key": VALID_API_KEY, "api_secret": VALID_API_SECRET, "base_url": srv.URL},
+			env:    map[string]string{"TURRETIO_API_VERSION": "v1"},
+			code:   1,
+			stderr: "404",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			var args []string
+			if tt.config != nil {
+				args = append(args, "-config", write(tt.config))
+			}
+			args = append(args, tt.flags...)
+			code, stdout, stderr := runCLI(append(args, "account", "get")...)
+			if code != tt.code {
+				t.Errorf("exit code %d, want %d\nstdout: %s\nstderr: %s", code, tt.code, stdout, stderr)
+			}
+			if !strings.Contains(stderr, tt.stderr) {
+				t.Errorf("stderr should contain %q, got %s", tt.stderr, stderr)
+			}
+		})
+	}
+
+	if code, _, stderr := runCLI("-config", filepath.Join(t.TempDir(), "missing.json"), "account", "get"); code != 1 || !strings.Contains(stderr, "no such file") {
+		t.Errorf("a missing explicit config file should fail, got %d: %s", code, stderr)
+	}
+}
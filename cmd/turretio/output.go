@@ -0,0 +1,90 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+const OUTPUT_JSON = "json"
+const OUTPUT_TABLE = "table"
+
+// printer writes API responses in the format selected with -output
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+// print writes the raw response body of a call, so fields unknown to the
+// library are shown too
+func (p *printer) print(body map[string]interface{}) error {
+	if body == nil {
+		body = map[string]interface{}{}
+	}
+	if p.format == OUTPUT_TABLE {
+		return p.table(body)
+	}
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(body)
+}
+
+// table writes one key/value row per field, nested fields flattened with dots
+func (p *printer) table(body map[string]interface{}) error {
+	rows := make(map[string]string)
+	flatten("", body, rows)
+	keys := make([]string, 0, len(rows))
+	for k := range rows {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FIELD\tVALUE")
+	for _, k := range keys {
+		fmt.Fprintf(tw, "%s\t%s\n", k, rows[k])
+	}
+	return tw.Flush()
+}
+
+func flatten(prefix string, v interface{}, rows map[string]string) {
+	join := func(k string) string {
+		if prefix == "" {
+			return k
+		}
+		return prefix + "." + k
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			flatten(join(k), child, rows)
+		}
+	case []interface{}:
+		for i, child := range v {
+			flatten(join(fmt.Sprint(i)), child, rows)
+		}
+	case nil:
+		rows[prefix] = ""
+	case string:
+		rows[prefix] = v
+	default:
+		j, _ := json.Marshal(v)
+		rows[prefix] = string(j)
+	}
+}
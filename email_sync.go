@@ -0,0 +1,261 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Files of an email definition directory, <target>/<email_id>/
+const SYNC_SUBJECT_FILE = "subject.txt"
+const SYNC_HTML_FILE = "body.html"
+const SYNC_PLAIN_FILE = "body.txt"
+
+const SYNC_UNCHANGED = "unchanged"
+const SYNC_UPDATE = "update"
+const SYNC_MISSING = "missing"
+
+// EmailDefinition is the content of a target email as kept under version control
+type EmailDefinition struct {
+	Target string
+	ID     string
+	EmailContent
+	// Dir is the directory the definition was read from
+	Dir string
+}
+
+// LoadEmailDefinitions reads the definitions of fsys, laid out as
+// <target>/<email_id>/ directories holding SYNC_SUBJECT_FILE, SYNC_HTML_FILE
+// and optionally SYNC_PLAIN_FILE. Use os.DirFS to read a directory.
+func LoadEmailDefinitions(fsys fs.FS) ([]EmailDefinition, error) {
+	var defs []EmailDefinition
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() != SYNC_SUBJECT_FILE {
+			return nil
+		}
+		dir := path.Dir(p)
+		parts := strings.Split(dir, "/")
+		if len(parts) != 2 {
+			return fmt.Errorf("%w: %s is not in a <target>/<email_id> directory", ErrValidation, p)
+		}
+		def := EmailDefinition{Target: parts[0], ID: parts[1], Dir: dir}
+		if def.Subject, err = readDefinitionFile(fsys, dir, SYNC_SUBJECT_FILE, true); err != nil {
+			return err
+		}
+		def.Subject = strings.TrimSpace(def.Subject)
+		if def.HTML, err = readDefinitionFile(fsys, dir, SYNC_HTML_FILE, true); err != nil {
+			return err
+		}
+		if def.Plain, err = readDefinitionFile(fsys, dir, SYNC_PLAIN_FILE, false); err != nil {
+			return err
+		}
+		defs = append(defs, def)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(defs, func(i, j int) bool {
+		if defs[i].Target != defs[j].Target {
+			return defs[i].Target < defs[j].Target
+		}
+		return defs[i].ID < defs[j].ID
+	})
+	return defs, nil
+}
+
+func readDefinitionFile(fsys fs.FS, dir string, name string, required bool) (string, error) {
+	data, err := fs.ReadFile(fsys, path.Join(dir, name))
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return normalizeContent(string(data)), nil
+}
+
+// normalizeContent ignores line ending styles and the trailing newline of files
+func normalizeContent(s string) string {
+	return strings.TrimRight(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+}
+
+// EmailChange is what applying a plan does to one target email
+type EmailChange struct {
+	Definition EmailDefinition
+	// Action is SYNC_UNCHANGED, SYNC_UPDATE or SYNC_MISSING. Missing emails
+	// are not created, as Turret.IO assigns the ID of new emails.
+	Action string
+	// Content is what Update will send, after the TargetEmail options ran
+	Content EmailContent
+	// Current is the email as returned by TargetEmail.Get, nil if missing
+	Current *TargetEmailRecord
+	// Fields lists the changed fields: FIELD_SUBJECT, FIELD_HTML or FIELD_PLAIN
+	Fields []string
+	// keepPlain is set when the definition has no plain body, which leaves
+	// the plain body of the email as it is
+	keepPlain bool
+}
+
+// EmailSyncPlan lists the changes needed to bring Turret.IO in line with a set of definitions
+type EmailSyncPlan struct {
+	Changes []EmailChange
+}
+
+// Count returns the number of changes with the given action
+func (p *EmailSyncPlan) Count(action string) int {
+	n := 0
+	for _, c := range p.Changes {
+		if c.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// String describes the plan with a diff of every changed field
+func (p *EmailSyncPlan) String() string {
+	var b strings.Builder
+	for _, c := range p.Changes {
+		name := c.Definition.Target + "/" + c.Definition.ID
+		switch c.Action {
+		case SYNC_MISSING:
+			fmt.Fprintf(&b, "! %s does not exist, create it and rename %s to the new ID\n", name, c.Definition.Dir)
+		case SYNC_UPDATE:
+			fmt.Fprintf(&b, "~ %s\n", name)
+			for _, f := range c.Fields {
+				fmt.Fprintf(&b, "  %s:\n", f)
+				for _, l := range lineDiff(normalizeContent(emailField(c.Current.Content(), f)), emailField(c.Content, f)) {
+					fmt.Fprintf(&b, "    %s\n", l)
+				}
+			}
+		}
+	}
+	fmt.Fprintf(&b, "%d to update, %d unchanged, %d missing\n", p.Count(SYNC_UPDATE), p.Count(SYNC_UNCHANGED), p.Count(SYNC_MISSING))
+	return b.String()
+}
+
+// emailField returns one field of c
+func emailField(c EmailContent, field string) string {
+	switch field {
+	case FIELD_SUBJECT:
+		return c.Subject
+	case FIELD_HTML:
+		return c.HTML
+	}
+	return c.Plain
+}
+
+// EmailSync updates target emails from definitions kept under version control
+type EmailSync struct {
+	// TargetEmail reads and updates the emails, its options apply to the definitions
+	TargetEmail *TargetEmail
+}
+
+// NewEmailSync creates an EmailSync using te
+func NewEmailSync(te *TargetEmail) *EmailSync {
+	return &EmailSync{TargetEmail: te}
+}
+
+// PlanContext compares defs with the emails returned by TargetEmail.Get. It
+// returns an error if a definition fails the TargetEmail checks. A definition
+// without plain body, e.g. without SYNC_PLAIN_FILE, leaves the plain body of
+// the email unchanged unless TargetEmail derives one with WithDerivedPlain.
+func (s *EmailSync) PlanContext(ctx context.Context, defs []EmailDefinition) (*EmailSyncPlan, error) {
+	plan := &EmailSyncPlan{}
+	for _, def := range defs {
+		prepared, err := s.TargetEmail.prepare(def.EmailContent)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", def.Dir, err)
+		}
+		change := EmailChange{Definition: def, Content: prepared.EmailContent}
+
+		current, err := s.TargetEmail.GetContext(ctx, def.Target, def.ID)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			change.Action = SYNC_MISSING
+		case err != nil:
+			return nil, fmt.Errorf("%s: %w", def.Dir, err)
+		default:
+			change.Current = current
+			if strings.TrimSpace(change.Content.Plain) == "" {
+				change.Content.Plain = normalizeContent(current.Plain)
+				change.keepPlain = true
+			}
+			for _, f := range []string{FIELD_SUBJECT, FIELD_HTML, FIELD_PLAIN} {
+				if fieldChanged(f, current.Content(), change.Content) {
+					change.Fields = append(change.Fields, f)
+				}
+			}
+			change.Action = SYNC_UNCHANGED
+			if len(change.Fields) > 0 {
+				change.Action = SYNC_UPDATE
+			}
+		}
+		plan.Changes = append(plan.Changes, change)
+	}
+	return plan, nil
+}
+
+// fieldChanged reports whether field differs between the current and the
+// wanted content, ignoring the whitespace around the subject
+func fieldChanged(field string, current EmailContent, wanted EmailContent) bool {
+	got, want := normalizeContent(emailField(current, field)), emailField(wanted, field)
+	if field == FIELD_SUBJECT {
+		got, want = strings.TrimSpace(got), strings.TrimSpace(want)
+	}
+	return got != want
+}
+
+// Plan works like PlanContext using context.Background()
+func (s *EmailSync) Plan(defs []EmailDefinition) (*EmailSyncPlan, error) {
+	return s.PlanContext(context.Background(), defs)
+}
+
+// ApplyContext updates the emails plan marks SYNC_UPDATE, in order, and
+// returns the records of the updated ones. It stops at the first error.
+func (s *EmailSync) ApplyContext(ctx context.Context, plan *EmailSyncPlan) ([]*TargetEmailRecord, error) {
+	var updated []*TargetEmailRecord
+	for _, c := range plan.Changes {
+		if c.Action != SYNC_UPDATE {
+			continue
+		}
+		d := c.Definition
+		plain := d.Plain
+		if c.keepPlain {
+			plain = c.Current.Plain
+		}
+		r, err := s.TargetEmail.UpdateContext(ctx, d.Target, d.ID, d.Subject, d.HTML, plain)
+		if err != nil {
+			return updated, fmt.Errorf("%s: %w", d.Dir, err)
+		}
+		updated = append(updated, r)
+	}
+	return updated, nil
+}
+
+// Apply works like ApplyContext using context.Background()
+func (s *EmailSync) Apply(plan *EmailSyncPlan) ([]*TargetEmailRecord, error) {
+	return s.ApplyContext(context.Background(), plan)
+}
@@ -0,0 +1,102 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Sentinel errors matched by APIError through errors.Is
+var (
+	ErrUnauthorized = errors.New("turretIO: unauthorized")
+	ErrNotFound     = errors.New("turretIO: not found")
+	ErrRateLimited  = errors.New("turretIO: rate limited")
+	ErrValidation   = errors.New("turretIO: validation failed")
+)
+
+// Errors returned by Verifier.Verify
+var (
+	ErrInvalidSignature = errors.New("turretIO: invalid request signature")
+	ErrStaleRequest     = errors.New("turretIO: request timestamp outside allowed skew")
+	ErrReplayedRequest  = errors.New("turretIO: replayed request")
+	ErrBodyTooLarge     = errors.New("turretIO: request body too large")
+)
+
+// APIError is returned for every non-2xx response from the Turret.IO API
+type APIError struct {
+	StatusCode int
+	Status     string
+	Method     string
+	Path       string
+	// Body holds the decoded JSON error body, nil if the body was not JSON
+	Body map[string]interface{}
+	// RawBody holds the response body as received
+	RawBody []byte
+	Header  http.Header
+}
+
+func newAPIError(method string, path string, response *http.Response, body []byte) *APIError {
+	e := &APIError{
+		StatusCode: response.StatusCode,
+		Status:     response.Status,
+		Method:     method,
+		Path:       path,
+		RawBody:    body,
+		Header:     response.Header,
+	}
+	var jbody map[string]interface{}
+	if err := json.Unmarshal(body, &jbody); err == nil {
+		e.Body = jbody
+	}
+	return e
+}
+
+// Message returns the error message sent by the API, falling back to the raw body
+func (e *APIError) Message() string {
+	for _, k := range []string{"error", "message", "msg"} {
+		if m, ok := e.Body[k].(string); ok {
+			return m
+		}
+	}
+	return strings.TrimSpace(string(e.RawBody))
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("turretIO: %s %s: %s", e.Method, e.Path, e.Status)
+	if m := e.Message(); m != "" {
+		msg = fmt.Sprintf("%s: %s", msg, m)
+	}
+	return msg
+}
+
+// Is reports whether the status code of e corresponds to target, one of
+// ErrUnauthorized, ErrNotFound, ErrRateLimited or ErrValidation
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrValidation:
+		return e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusUnprocessableEntity
+	}
+	return false
+}
@@ -0,0 +1,3 @@
+module github.com/turretIO/turret-io-go
+
+go 1.22
@@ -0,0 +1,146 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var htmlAttribute = regexp.MustCompile(`(?is)([a-z-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+
+const (
+	htmlText = iota
+	htmlStartTag
+	htmlEndTag
+)
+
+// htmlToken is a piece of an HTML document found by scanHTML
+type htmlToken struct {
+	kind int
+	// offset is the byte offset of the token in the document
+	offset int
+	// text is the unescaped text of an htmlText token
+	text string
+	// name is the lower case tag name of tags
+	name string
+	// attrs is the raw attribute text of start tags, see htmlAttributes
+	attrs       string
+	selfClosing bool
+}
+
+// scanHTML calls fn for every text run and tag of s. It is lenient, as email
+// HTML rarely validates: comments, doctypes and the content of scripts and
+// styles are skipped and a "<" that does not start markup is text.
+func scanHTML(s string, fn func(tok htmlToken)) {
+	for i := 0; i < len(s); {
+		if s[i] != '<' {
+			j := strings.IndexByte(s[i:], '<')
+			if j < 0 {
+				j = len(s) - i
+			}
+			fn(htmlToken{kind: htmlText, offset: i, text: html.UnescapeString(s[i : i+j])})
+			i += j
+			continue
+		}
+		switch {
+		case i+1 == len(s) || !(isASCIILetter(s[i+1]) || strings.ContainsRune("/!?", rune(s[i+1]))):
+			fn(htmlToken{kind: htmlText, offset: i, text: "<"})
+			i++
+			continue
+		case strings.HasPrefix(s[i:], "<!--"):
+			i = skipPast(s, i+4, "-->")
+			continue
+		case strings.HasPrefix(s[i:], "<!"), strings.HasPrefix(s[i:], "<?"):
+			i = skipPast(s, i+2, ">")
+			continue
+		}
+
+		start := i
+		end := tagEnd(s, i)
+		tag := s[i+1 : end]
+		i = end + 1
+		closing := strings.HasPrefix(tag, "/")
+		tag = strings.TrimPrefix(tag, "/")
+		n := 0
+		for n < len(tag) && (isASCIILetter(tag[n]) || (n > 0 && tag[n] >= '0' && tag[n] <= '9')) {
+			n++
+		}
+		if n == 0 {
+			continue
+		}
+		tok := htmlToken{kind: htmlStartTag, offset: start, name: strings.ToLower(tag[:n])}
+		if closing {
+			tok.kind = htmlEndTag
+			fn(tok)
+			continue
+		}
+		tok.attrs = tag[n:]
+		tok.selfClosing = strings.HasSuffix(strings.TrimSpace(tok.attrs), "/")
+		fn(tok)
+		if (tok.name == "script" || tok.name == "style") && !tok.selfClosing {
+			closeAt := skipPast(s, i, "</"+tok.name)
+			if closeAt == len(s) {
+				i = len(s)
+				continue
+			}
+			i = closeAt - len(tok.name) - 2
+		}
+	}
+}
+
+func isASCIILetter(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+// skipPast returns the index following the first marker after from, or the end of s
+func skipPast(s string, from int, marker string) int {
+	if from > len(s) {
+		return len(s)
+	}
+	j := strings.Index(strings.ToLower(s[from:]), marker)
+	if j < 0 {
+		return len(s)
+	}
+	return from + j + len(marker)
+}
+
+// tagEnd returns the index of the ">" closing the tag opened at i, skipping quoted attributes
+func tagEnd(s string, i int) int {
+	var quote byte
+	for j := i + 1; j < len(s); j++ {
+		switch {
+		case quote != 0:
+			if s[j] == quote {
+				quote = 0
+			}
+		case s[j] == '"' || s[j] == '\'':
+			quote = s[j]
+		case s[j] == '>':
+			return j
+		}
+	}
+	return len(s) - 1
+}
+
+// htmlAttributes parses the attributes of a start tag, names lower cased
+func htmlAttributes(attrs string) map[string]string {
+	m := make(map[string]string)
+	for _, match := range htmlAttribute.FindAllStringSubmatch(attrs, -1) {
+		m[strings.ToLower(match[1])] = html.UnescapeString(match[2] + match[3] + match[4])
+	}
+	return m
+}
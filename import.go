@@ -0,0 +1,362 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const DEFAULT_EMAIL_COLUMN = "email"
+const DEFAULT_CHECKPOINT_EVERY = 100
+
+// ColumnMapping says how CSV columns become a user. Columns listed in
+// Properties are sent as properties and columns listed in Attributes as
+// attributes. When Attributes is empty every other column is an attribute.
+type ColumnMapping struct {
+	// Email is the column holding the email address, defaults to DEFAULT_EMAIL_COLUMN
+	Email      string
+	Attributes []string
+	Properties []string
+}
+
+// ImportSummary counts the rows handled by an import
+type ImportSummary struct {
+	// Skipped rows were imported by a previous run, according to the checkpoint
+	Skipped  int
+	Imported int
+	Rejected int
+}
+
+// UserImporter loads users from CSV or JSON Lines with User.Set. Rows that
+// fail validation or are refused by the API are written to Rejects and do not
+// stop the import. Any other error stops it; with CheckpointPath set, running
+// the import again on the same input resumes after the last completed row.
+type UserImporter struct {
+	User    *User
+	Mapping ColumnMapping
+	// Rejects receives rejected rows, in the input format with the error
+	// added: an extra "error" column for CSV, an "error" field for JSON Lines
+	Rejects io.Writer
+	// OmitRejectsHeader leaves out the CSV header of Rejects, for instance
+	// when appending to the rejects of an interrupted import
+	OmitRejectsHeader bool
+	// CheckpointPath is a file holding the number of the last completed row
+	CheckpointPath string
+	// CheckpointEvery is the number of rows between checkpoint writes,
+	// defaults to DEFAULT_CHECKPOINT_EVERY
+	CheckpointEvery int
+	// OnRow, when set, is called after every completed row with its 1-based
+	// number and its error, nil if the row was imported
+	OnRow func(row int, err error)
+}
+
+// NewUserImporter creates a UserImporter sending through u
+func NewUserImporter(u *User) *UserImporter {
+	return &UserImporter{User: u, CheckpointEvery: DEFAULT_CHECKPOINT_EVERY}
+}
+
+// ImportCSV imports users from r, a CSV file with a header row. Malformed
+// rows, e.g. with a bare quote, are rejected with their csv.ParseError.
+func (im *UserImporter) ImportCSV(ctx context.Context, r io.Reader) (*ImportSummary, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("turretIO: reading CSV header: %w", err)
+	}
+	columns, err := im.mapColumns(header)
+	if err != nil {
+		return nil, err
+	}
+
+	var rejects *csv.Writer
+	if im.Rejects != nil {
+		rejects = csv.NewWriter(im.Rejects)
+		defer rejects.Flush()
+	}
+	rejectHeaderWritten := im.OmitRejectsHeader
+
+	return im.run(ctx, func() (*UserBatchItem, func(error) error, error) {
+		record, err := cr.Read()
+		var parseErr *csv.ParseError
+		if err != nil && !errors.As(err, &parseErr) {
+			return nil, nil, err
+		}
+		if parseErr != nil {
+			// the reader returns no fields, the error locates the row
+			record = make([]string, len(header))
+		}
+		reject := func(rowErr error) error {
+			if rejects == nil {
+				return nil
+			}
+			if !rejectHeaderWritten {
+				rejects.Write(append(append([]string(nil), header...), "error"))
+				rejectHeaderWritten = true
+			}
+			rejects.Write(append(record, rowErr.Error()))
+			rejects.Flush()
+			return rejects.Error()
+		}
+		if parseErr != nil {
+			return nil, reject, err
+		}
+		item := UserBatchItem{Attributes: make(map[string]string), Properties: make(map[string]string)}
+		for i, value := range record {
+			if i >= len(columns) || value == "" {
+				continue
+			}
+			switch columns[i] {
+			case columnEmail:
+				item.Email = strings.TrimSpace(value)
+			case columnAttribute:
+				item.Attributes[header[i]] = value
+			case columnProperty:
+				item.Properties[header[i]] = value
+			}
+		}
+		return &item, reject, nil
+	})
+}
+
+// ImportJSONL imports users from r, one JSON object per line of the form
+// {"email": "...", "attributes": {...}, "properties": {...}}. Blank lines are
+// skipped but still counted, so row numbers are line numbers.
+func (im *UserImporter) ImportJSONL(ctx context.Context, r io.Reader) (*ImportSummary, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+
+	return im.run(ctx, func() (*UserBatchItem, func(error) error, error) {
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return nil, nil, err
+			}
+			return nil, nil, io.EOF
+		}
+		line := append([]byte(nil), scanner.Bytes()...)
+		reject := func(rowErr error) error {
+			if im.Rejects == nil {
+				return nil
+			}
+			j, _ := json.Marshal(map[string]interface{}{"line": string(line), "error": rowErr.Error()})
+			_, err := im.Rejects.Write(append(j, '\n'))
+			return err
+		}
+
+		var user struct {
+			Email      string    `json:"email"`
+			Attributes StringMap `json:"attributes"`
+			Properties StringMap `json:"properties"`
+		}
+		if len(strings.TrimSpace(string(line))) == 0 {
+			return nil, nil, nil
+		}
+		if err := json.Unmarshal(line, &user); err != nil {
+			return nil, reject, err
+		}
+		return &UserBatchItem{Email: strings.TrimSpace(user.Email), Attributes: user.Attributes, Properties: user.Properties}, reject, nil
+	})
+}
+
+// nextRow returns the next item and a function writing it to the rejects.
+// A nil item with a non-nil reject function is a malformed row, a nil item
+// without error or reject function a blank one.
+type nextRow func() (*UserBatchItem, func(error) error, error)
+
+func (im *UserImporter) run(ctx context.Context, next nextRow) (*ImportSummary, error) {
+	summary := &ImportSummary{}
+	done, err := im.readCheckpoint()
+	if err != nil {
+		return nil, err
+	}
+	every := im.CheckpointEvery
+	if every < 1 {
+		every = DEFAULT_CHECKPOINT_EVERY
+	}
+
+	// stop records completed as the last completed row and returns err. The
+	// checkpoint is only ever moved forward, so stopping while the rows of a
+	// previous run are skipped keeps it.
+	stop := func(completed int, err error) error {
+		if completed <= done {
+			return err
+		}
+		if cerr := im.writeCheckpoint(completed); cerr != nil {
+			return errors.Join(err, fmt.Errorf("turretIO: writing checkpoint: %w", cerr))
+		}
+		return err
+	}
+
+	row := 0
+	for {
+		item, reject, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil && reject == nil {
+			return summary, stop(row, fmt.Errorf("turretIO: reading row %d: %w", row+1, err))
+		}
+		row++
+		if item == nil && err == nil {
+			continue
+		}
+		if row <= done {
+			summary.Skipped++
+			continue
+		}
+
+		rowErr := err
+		if rowErr == nil {
+			rowErr = validateImportItem(item)
+		}
+		if rowErr == nil {
+			_, rowErr = im.User.SetContext(ctx, item.Email, item.Attributes, item.Properties)
+			if rowErr != nil && !isRejection(rowErr) {
+				return summary, stop(row-1, fmt.Errorf("turretIO: importing row %d: %w", row, rowErr))
+			}
+		}
+
+		if rowErr != nil {
+			summary.Rejected++
+			if err := reject(rowErr); err != nil {
+				return summary, stop(row-1, fmt.Errorf("turretIO: writing rejected row %d: %w", row, err))
+			}
+		} else {
+			summary.Imported++
+		}
+		if im.OnRow != nil {
+			im.OnRow(row, rowErr)
+		}
+		if row%every == 0 {
+			if err := im.writeCheckpoint(row); err != nil {
+				return summary, err
+			}
+		}
+	}
+	return summary, im.writeCheckpoint(row)
+}
+
+// isRejection reports whether the API refused the row itself, as opposed to
+// failing for reasons that retrying the import later may fix
+func isRejection(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.StatusCode >= 400 && apiErr.StatusCode < 500 &&
+		apiErr.StatusCode != http.StatusUnauthorized && apiErr.StatusCode != http.StatusForbidden &&
+		apiErr.StatusCode != http.StatusTooManyRequests
+}
+
+func validateImportItem(item *UserBatchItem) error {
+	if item.Email == "" {
+		return fmt.Errorf("%w: missing email", ErrValidation)
+	}
+	addr, err := mail.ParseAddress(item.Email)
+	if err != nil || addr.Address != item.Email {
+		return fmt.Errorf("%w: invalid email %q", ErrValidation, item.Email)
+	}
+	return nil
+}
+
+type columnKind int
+
+const (
+	columnIgnored columnKind = iota
+	columnEmail
+	columnAttribute
+	columnProperty
+)
+
+func (im *UserImporter) mapColumns(header []string) ([]columnKind, error) {
+	email := im.Mapping.Email
+	if email == "" {
+		email = DEFAULT_EMAIL_COLUMN
+	}
+	index := make(map[string]int, len(header))
+	for i, h := range header {
+		index[h] = i
+	}
+	columns := make([]columnKind, len(header))
+	mark := func(names []string, kind columnKind) error {
+		for _, name := range names {
+			i, ok := index[name]
+			if !ok {
+				return fmt.Errorf("%w: column %q not found in CSV header", ErrValidation, name)
+			}
+			columns[i] = kind
+		}
+		return nil
+	}
+
+	if err := mark([]string{email}, columnEmail); err != nil {
+		return nil, err
+	}
+	if len(im.Mapping.Attributes) == 0 {
+		for i := range columns {
+			if columns[i] == columnIgnored {
+				columns[i] = columnAttribute
+			}
+		}
+	} else if err := mark(im.Mapping.Attributes, columnAttribute); err != nil {
+		return nil, err
+	}
+	if err := mark(im.Mapping.Properties, columnProperty); err != nil {
+		return nil, err
+	}
+	columns[index[email]] = columnEmail
+	return columns, nil
+}
+
+func (im *UserImporter) readCheckpoint() (int, error) {
+	if im.CheckpointPath == "" {
+		return 0, nil
+	}
+	data, err := os.ReadFile(im.CheckpointPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	row, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("turretIO: invalid checkpoint file %s: %w", im.CheckpointPath, err)
+	}
+	return row, nil
+}
+
+// writeCheckpoint records row as the last completed row, replacing the file atomically
+func (im *UserImporter) writeCheckpoint(row int) error {
+	if im.CheckpointPath == "" {
+		return nil
+	}
+	tmp := im.CheckpointPath + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.Itoa(row)+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, im.CheckpointPath)
+}
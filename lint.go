@@ -0,0 +1,306 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const LINT_ERROR = "error"
+const LINT_WARNING = "warning"
+
+const LINT_UNSUBSCRIBE = "unsubscribe"
+const LINT_SIZE = "size"
+const LINT_UNBALANCED_TAG = "unbalanced-tag"
+const LINT_IMAGE_ALT = "image-alt"
+const LINT_RELATIVE_LINK = "relative-link"
+const LINT_SUBJECT = "subject"
+
+// DEFAULT_LINT_MAX_HTML_BYTES is where Gmail starts clipping messages
+const DEFAULT_LINT_MAX_HTML_BYTES = 102 * 1024
+const DEFAULT_LINT_MAX_SUBJECT_LENGTH = 78
+
+// html elements without end tag, and elements whose end tag may be omitted
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "param": true, "source": true, "track": true, "wbr": true,
+}
+var optionalEndElements = map[string]bool{
+	"p": true, "li": true, "dt": true, "dd": true, "tr": true, "td": true, "th": true,
+	"thead": true, "tbody": true, "tfoot": true, "option": true, "html": true, "head": true, "body": true,
+}
+
+// LintIssue is one problem found by Lint
+type LintIssue struct {
+	// Rule is one of the LINT_ rule names
+	Rule string
+	// Severity is LINT_ERROR or LINT_WARNING
+	Severity string
+	// Field is FIELD_SUBJECT, FIELD_HTML or FIELD_PLAIN
+	Field string
+	// Offset is the byte offset of the problem in Field, -1 if it has none
+	Offset  int
+	Message string
+}
+
+func (i LintIssue) String() string {
+	if i.Offset < 0 {
+		return fmt.Sprintf("%s: %s [%s]", i.Severity, i.Message, i.Rule)
+	}
+	return fmt.Sprintf("%s: %s at %s offset %d [%s]", i.Severity, i.Message, i.Field, i.Offset, i.Rule)
+}
+
+// LintIssues is the result of Lint
+type LintIssues []LintIssue
+
+// Errors returns the issues of severity LINT_ERROR
+func (l LintIssues) Errors() LintIssues {
+	var errs LintIssues
+	for _, i := range l {
+		if i.Severity == LINT_ERROR {
+			errs = append(errs, i)
+		}
+	}
+	return errs
+}
+
+// Err returns a *LintError if there are issues of severity LINT_ERROR, nil otherwise
+func (l LintIssues) Err() error {
+	if errs := l.Errors(); len(errs) > 0 {
+		return &LintError{errs}
+	}
+	return nil
+}
+
+// LintError is returned by TargetEmail.Create and Update when linting finds errors
+type LintError struct {
+	Issues LintIssues
+}
+
+func (e *LintError) Error() string {
+	msgs := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		msgs[i] = issue.String()
+	}
+	return "turretIO: lint failed: " + strings.Join(msgs, "; ")
+}
+
+// Is makes errors.Is(err, ErrValidation) match a LintError
+func (e *LintError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// Linter checks email content for common deliverability problems
+type Linter struct {
+	// MaxHTMLBytes is the largest HTML body accepted, defaults to DEFAULT_LINT_MAX_HTML_BYTES
+	MaxHTMLBytes int
+	// MaxSubjectLength is the longest subject, in characters, before a
+	// warning, defaults to DEFAULT_LINT_MAX_SUBJECT_LENGTH
+	MaxSubjectLength int
+	// UnsubscribeMarkers are matched, case insensitively, against link
+	// targets, link text and placeholder names to find the unsubscribe link.
+	// Defaults to "unsubscribe".
+	UnsubscribeMarkers []string
+	// Severity overrides the severity of rules by name, "" disables a rule
+	Severity map[string]string
+}
+
+// NewLinter creates a Linter with the default limits
+func NewLinter() *Linter {
+	return &Linter{
+		MaxHTMLBytes:       DEFAULT_LINT_MAX_HTML_BYTES,
+		MaxSubjectLength:   DEFAULT_LINT_MAX_SUBJECT_LENGTH,
+		UnsubscribeMarkers: []string{"unsubscribe"},
+	}
+}
+
+// Lint checks content with a default Linter
+func Lint(content EmailContent) LintIssues {
+	return NewLinter().Lint(content)
+}
+
+// WithLint makes TargetEmail.Create and Update return a *LintError, without
+// calling the API, when l finds errors in the content. Warnings are returned
+// in TargetEmailRecord.LintIssues.
+func WithLint(l *Linter) TargetEmailOption {
+	return func(te *TargetEmail) {
+		te.linter = l
+	}
+}
+
+// Lint checks content and returns the issues found, errors first
+func (l *Linter) Lint(content EmailContent) LintIssues {
+	var issues LintIssues
+	report := func(rule string, severity string, field string, offset int, format string, a ...interface{}) {
+		if s, ok := l.Severity[rule]; ok {
+			severity = s
+		}
+		if severity == "" {
+			return
+		}
+		issues = append(issues, LintIssue{Rule: rule, Severity: severity, Field: field, Offset: offset, Message: fmt.Sprintf(format, a...)})
+	}
+
+	maxSubject := l.MaxSubjectLength
+	if maxSubject <= 0 {
+		maxSubject = DEFAULT_LINT_MAX_SUBJECT_LENGTH
+	}
+	if strings.TrimSpace(content.Subject) == "" {
+		report(LINT_SUBJECT, LINT_ERROR, FIELD_SUBJECT, -1, "subject is empty")
+	} else if n := utf8.RuneCountInString(content.Subject); n > maxSubject {
+		report(LINT_SUBJECT, LINT_WARNING, FIELD_SUBJECT, -1, "subject is %d characters, over %d", n, maxSubject)
+	}
+
+	maxHTML := l.MaxHTMLBytes
+	if maxHTML <= 0 {
+		maxHTML = DEFAULT_LINT_MAX_HTML_BYTES
+	}
+	if len(content.HTML) > maxHTML {
+		report(LINT_SIZE, LINT_ERROR, FIELD_HTML, -1, "HTML body is %d bytes, over %d", len(content.HTML), maxHTML)
+	}
+
+	// only a link counts: the word alone in the plain text does not let anyone unsubscribe
+	unsubscribe := false
+	var open []htmlToken
+	inLink := false
+	var linkText strings.Builder
+	scanHTML(content.HTML, func(tok htmlToken) {
+		switch tok.kind {
+		case htmlText:
+			if inLink {
+				linkText.WriteString(tok.text)
+			}
+			unsubscribe = unsubscribe || l.hasUnsubscribePlaceholder(tok.text)
+		case htmlStartTag:
+			attrs := htmlAttributes(tok.attrs)
+			switch tok.name {
+			case "a":
+				if href, ok := attrs["href"]; ok {
+					unsubscribe = unsubscribe || l.hasUnsubscribe(href)
+					if !absoluteLink(href) {
+						report(LINT_RELATIVE_LINK, LINT_ERROR, FIELD_HTML, tok.offset, "link %q is not absolute", href)
+					}
+				}
+				inLink = true
+				linkText.Reset()
+			case "img":
+				src, ok := attrs["src"]
+				if ok && !absoluteLink(src) && !embeddedImage(src) {
+					report(LINT_RELATIVE_LINK, LINT_ERROR, FIELD_HTML, tok.offset, "image %q is not absolute", src)
+				}
+				remote := strings.HasPrefix(strings.ToLower(src), "http")
+				if alt, ok := attrs["alt"]; remote && (!ok || strings.TrimSpace(alt) == "") {
+					report(LINT_IMAGE_ALT, LINT_WARNING, FIELD_HTML, tok.offset, "image %q has no alt text", src)
+				}
+			}
+			if !voidElements[tok.name] && !tok.selfClosing {
+				open = append(open, tok)
+			}
+		case htmlEndTag:
+			if tok.name == "a" && inLink {
+				unsubscribe = unsubscribe || l.hasUnsubscribe(linkText.String())
+				inLink = false
+			}
+			if voidElements[tok.name] {
+				return
+			}
+			i := len(open) - 1
+			for i >= 0 && open[i].name != tok.name {
+				i--
+			}
+			if i < 0 {
+				report(LINT_UNBALANCED_TAG, LINT_ERROR, FIELD_HTML, tok.offset, "</%s> closes no open <%s>", tok.name, tok.name)
+				return
+			}
+			for _, unclosed := range open[i+1:] {
+				if !optionalEndElements[unclosed.name] {
+					report(LINT_UNBALANCED_TAG, LINT_ERROR, FIELD_HTML, unclosed.offset, "<%s> is not closed before </%s>", unclosed.name, tok.name)
+				}
+			}
+			open = open[:i]
+		}
+	})
+	for _, unclosed := range open {
+		if !optionalEndElements[unclosed.name] {
+			report(LINT_UNBALANCED_TAG, LINT_ERROR, FIELD_HTML, unclosed.offset, "<%s> is never closed", unclosed.name)
+		}
+	}
+
+	if !unsubscribe {
+		report(LINT_UNSUBSCRIBE, LINT_ERROR, "", -1, "no unsubscribe link")
+	}
+	sort.SliceStable(issues, func(i, j int) bool {
+		return issues[i].Severity == LINT_ERROR && issues[j].Severity != LINT_ERROR
+	})
+	return issues
+}
+
+func (l *Linter) markers() []string {
+	if len(l.UnsubscribeMarkers) == 0 {
+		return []string{"unsubscribe"}
+	}
+	return l.UnsubscribeMarkers
+}
+
+func (l *Linter) hasUnsubscribe(s string) bool {
+	s = strings.ToLower(s)
+	for _, m := range l.markers() {
+		if strings.Contains(s, strings.ToLower(m)) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasUnsubscribePlaceholder finds placeholders such as {{unsubscribe_url}} in text
+func (l *Linter) hasUnsubscribePlaceholder(text string) bool {
+	for _, name := range NewRenderer().Placeholders(EmailContent{HTML: text}) {
+		if l.hasUnsubscribe(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// embeddedImage reports whether src is an image carried by the email itself:
+// an attachment referenced by its Content-ID or a data: URI
+func embeddedImage(src string) bool {
+	src = strings.ToLower(strings.TrimSpace(src))
+	return strings.HasPrefix(src, "cid:") || strings.HasPrefix(src, "data:")
+}
+
+// absoluteLink reports whether href works outside of a web page: an absolute
+// URL, a mailto: or tel: link, an in-page anchor or a placeholder
+func absoluteLink(href string) bool {
+	href = strings.TrimSpace(href)
+	if strings.HasPrefix(href, "#") || strings.HasPrefix(href, PLACEHOLDER_OPEN) {
+		return true
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.Host != ""
+	case "mailto", "tel":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// REDACTED replaces secrets in logged headers and payloads
+const REDACTED = "[REDACTED]"
+
+// headers carrying credentials, in canonical form
+var redactedHeaders = map[string]bool{
+	"X-Ls-Auth": true,
+	"X-Ls-Key":  true,
+}
+
+// payload keys carrying credentials, besides those containing "secret" or "password"
+var redactedKeys = map[string]bool{
+	AWS_ACCESS_KEY_NAME:        true,
+	AWS_SECRET_ACCESS_KEY_NAME: true,
+	SMTP_PASSWORD_NAME:         true,
+}
+
+// WithLogger logs every call made through GetRequest and PostRequest to
+// logger: its method, path, resource, operation, status, latency and number
+// of attempts at slog.LevelInfo, or slog.LevelError when it fails. Each
+// attempt is logged at slog.LevelDebug with its redacted headers and payload,
+// which hold user attributes and email bodies.
+func WithLogger(logger *slog.Logger) Option {
+	return func(t *TurretIO) {
+		t.logger = logger
+	}
+}
+
+// logCall logs a call once it went through the middleware chain
+func (t *TurretIO) logCall(ctx context.Context, call *Call, resp *TurretIOResponse, err error, latency time.Duration) {
+	if t.logger == nil {
+		return
+	}
+	level := slog.LevelInfo
+	if err != nil {
+		level = slog.LevelError
+	}
+	if !t.logger.Enabled(ctx, level) {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("method", call.Method),
+		slog.String("path", call.Path),
+		slog.String("resource", call.Resource),
+	}
+	if call.Operation != "" {
+		attrs = append(attrs, slog.String("operation", call.Operation))
+	}
+	var apiErr *APIError
+	switch {
+	case resp != nil:
+		attrs = append(attrs, slog.Int("status", resp.StatusCode))
+	case errors.As(err, &apiErr):
+		attrs = append(attrs, slog.Int("status", apiErr.StatusCode))
+	}
+	attrs = append(attrs, slog.Duration("latency", latency), slog.Int("attempts", call.Attempts))
+	if call.Attempts > 1 {
+		attrs = append(attrs, slog.Int("retries", call.Attempts-1))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	t.logger.LogAttrs(ctx, level, "turretIO call", attrs...)
+}
+
+// logAttempt logs the headers and payload of a single request of call
+func (t *TurretIO) logAttempt(ctx context.Context, call *Call, header http.Header) {
+	if t.logger == nil || !t.logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("method", call.Method),
+		slog.String("path", call.Path),
+		slog.Int("attempt", call.Attempts),
+		slog.Any("header", RedactHeader(header)),
+	}
+	if call.Payload != nil {
+		attrs = append(attrs, slog.Any("payload", RedactPayload(call.Payload)))
+	}
+	t.logger.LogAttrs(ctx, slog.LevelDebug, "turretIO attempt", attrs...)
+}
+
+// RedactHeader returns a copy of h with the credential headers replaced by REDACTED
+func RedactHeader(h http.Header) http.Header {
+	redacted := make(http.Header, len(h))
+	for k, v := range h {
+		if redactedHeaders[http.CanonicalHeaderKey(k)] {
+			redacted[k] = []string{REDACTED}
+		} else {
+			redacted[k] = append([]string(nil), v...)
+		}
+	}
+	return redacted
+}
+
+// RedactPayload returns a copy of payload with secrets such as the
+// aws_secret_access_key and smtp_password of Account.Set replaced by REDACTED,
+// at any depth
+func RedactPayload(payload map[string]interface{}) map[string]interface{} {
+	if payload == nil {
+		return nil
+	}
+	return redactValue(payload).(map[string]interface{})
+}
+
+func redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			if isSecretKey(k) {
+				redacted[k] = REDACTED
+			} else {
+				redacted[k] = redactValue(child)
+			}
+		}
+		return redacted
+	case map[string]string:
+		redacted := make(map[string]string, len(v))
+		for k, child := range v {
+			if isSecretKey(k) {
+				redacted[k] = REDACTED
+			} else {
+				redacted[k] = child
+			}
+		}
+		return redacted
+	case []map[string]interface{}:
+		redacted := make([]map[string]interface{}, len(v))
+		for i, child := range v {
+			redacted[i] = redactValue(child).(map[string]interface{})
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, child := range v {
+			redacted[i] = redactValue(child)
+		}
+		return redacted
+	}
+	return v
+}
+
+func isSecretKey(k string) bool {
+	k = strings.ToLower(k)
+	return redactedKeys[k] || strings.Contains(k, "secret") || strings.Contains(k, "password")
+}
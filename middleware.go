@@ -0,0 +1,113 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Operations of the resource methods, as reported in Call.Operation
+const OPERATION_GET = "get"
+const OPERATION_SET = "set"
+const OPERATION_CREATE = "create"
+const OPERATION_UPDATE = "update"
+const OPERATION_SEND = "send"
+const OPERATION_SEND_TEST = "send_test"
+
+// Call is an API call on its way through the middleware chain
+type Call struct {
+	// Resource is one of the RESOURCE_* constants
+	Resource string
+	// Operation is one of the OPERATION_* constants, empty for calls made
+	// with GetRequest or PostRequest directly
+	Operation string
+	Method    string
+	// Path is relative to the versioned base URL, e.g. /user/john@example.com
+	Path string
+	// Target and EmailID are the target name and target email ID in Path, if any
+	Target  string
+	EmailID string
+	Payload map[string]interface{}
+	// Header holds extra headers sent with every attempt. The signature
+	// headers are set after them and cannot be overridden.
+	Header http.Header
+	// Attempts is the number of HTTP requests made for the call, set once
+	// the next Handler returns
+	Attempts int
+
+	// timestamp is the X-Ls-Time of the last attempt
+	timestamp int64
+}
+
+// Handler makes a Call, the innermost one signs and sends it with retries
+type Handler func(ctx context.Context, call *Call) (*TurretIOResponse, error)
+
+// Middleware wraps a Handler to observe or change calls, e.g.
+//
+//	func(next Handler) Handler {
+//		return func(ctx context.Context, call *Call) (*TurretIOResponse, error) {
+//			call.Header.Set("X-Request-Id", newID())
+//			return next(ctx, call)
+//		}
+//	}
+type Middleware func(next Handler) Handler
+
+// WithMiddleware adds middleware to the chain, see TurretIO.Use
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(t *TurretIO) {
+		t.Use(middleware...)
+	}
+}
+
+// Use adds middleware to the chain every call made through GetRequest and
+// PostRequest goes through. The first middleware added is the outermost.
+// Use must not be called concurrently with calls.
+func (t *TurretIO) Use(middleware ...Middleware) {
+	t.middleware = append(t.middleware, middleware...)
+}
+
+// targetForPath returns the target name and target email ID of a call to path
+func targetForPath(path string) (target_name string, email_id string) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if parts[0] != "target" || len(parts) < 2 {
+		return "", ""
+	}
+	if len(parts) > 3 && parts[2] == "email" {
+		return parts[1], parts[3]
+	}
+	return parts[1], ""
+}
+
+type operationKey struct{}
+
+// withOperation records the resource method making the call
+func withOperation(ctx context.Context, operation string) context.Context {
+	return context.WithValue(ctx, operationKey{}, operation)
+}
+
+func operationFrom(ctx context.Context) string {
+	op, _ := ctx.Value(operationKey{}).(string)
+	return op
+}
+
+// chain returns the Handler running the middleware around h
+func (t *TurretIO) chain(h Handler) Handler {
+	for i := len(t.middleware) - 1; i >= 0; i-- {
+		h = t.middleware[i](h)
+	}
+	return h
+}
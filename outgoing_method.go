@@ -0,0 +1,187 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// OutgoingMethod is the way an account sends email, passed to Account.Set
+type OutgoingMethod interface {
+	// Type returns the method name sent to the API, e.g. OUTGOING_METHOD_AWS_NAME
+	Type() string
+	// Validate reports missing or invalid configuration
+	Validate() error
+	// Options returns the options payload, nil if the method takes none
+	Options() map[string]interface{}
+}
+
+// TurretIOMethod sends email through Turret.IO itself
+type TurretIOMethod struct{}
+
+func (m TurretIOMethod) Type() string {
+	return OUTGOING_METHOD_TURRET_IO_NAME
+}
+
+func (m TurretIOMethod) Validate() error {
+	return nil
+}
+
+func (m TurretIOMethod) Options() map[string]interface{} {
+	return nil
+}
+
+// AWSSESMethod sends email through Amazon SES with the provided credentials.
+// Region is optional.
+type AWSSESMethod struct {
+	AccessKey string
+	SecretKey string
+	Region    string
+}
+
+func (m AWSSESMethod) Type() string {
+	return OUTGOING_METHOD_AWS_NAME
+}
+
+func (m AWSSESMethod) Validate() error {
+	if m.AccessKey == "" {
+		return fmt.Errorf("%w: outgoing method AWS requires aws access key", ErrValidation)
+	}
+	if m.SecretKey == "" {
+		return fmt.Errorf("%w: outgoing method AWS requires aws secret access key", ErrValidation)
+	}
+	return nil
+}
+
+func (m AWSSESMethod) Options() map[string]interface{} {
+	options := map[string]interface{}{
+		AWS_ACCESS_KEY_NAME:        m.AccessKey,
+		AWS_SECRET_ACCESS_KEY_NAME: m.SecretKey,
+	}
+	if m.Region != "" {
+		options[AWS_REGION_NAME] = m.Region
+	}
+	return options
+}
+
+// SMTPTLSMode selects how SMTPMethod secures the connection
+type SMTPTLSMode string
+
+const SMTP_TLS_MODE_NONE SMTPTLSMode = "none"
+const SMTP_TLS_MODE_STARTTLS SMTPTLSMode = "starttls"
+const SMTP_TLS_MODE_TLS SMTPTLSMode = "tls"
+
+// SMTPMethod sends email through an SMTP server. Port and TLSMode are
+// optional and left to the server default when unset.
+type SMTPMethod struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	TLSMode  SMTPTLSMode
+}
+
+func (m SMTPMethod) Type() string {
+	return OUTGOING_METHOD_SMTP_NAME
+}
+
+func (m SMTPMethod) Validate() error {
+	if m.Host == "" || m.Username == "" || m.Password == "" {
+		return fmt.Errorf("%w: outgoing method smtp requires options host name, username, password", ErrValidation)
+	}
+	if m.Port < 0 || m.Port > 65535 {
+		return fmt.Errorf("%w: invalid smtp port %d", ErrValidation, m.Port)
+	}
+	switch m.TLSMode {
+	case "", SMTP_TLS_MODE_NONE, SMTP_TLS_MODE_STARTTLS, SMTP_TLS_MODE_TLS:
+	default:
+		return fmt.Errorf("%w: invalid smtp tls mode %q", ErrValidation, m.TLSMode)
+	}
+	return nil
+}
+
+func (m SMTPMethod) Options() map[string]interface{} {
+	options := map[string]interface{}{
+		SMTP_HOST_NAME:     m.Host,
+		SMTP_USERNAME_NAME: m.Username,
+		SMTP_PASSWORD_NAME: m.Password,
+	}
+	if m.Port != 0 {
+		options[SMTP_PORT_NAME] = m.Port
+	}
+	if m.TLSMode != "" {
+		options[SMTP_TLS_MODE_NAME] = string(m.TLSMode)
+	}
+	return options
+}
+
+// ParseOutgoingMethod builds an OutgoingMethod from its name and an options
+// map keyed by the option names documented on Account.Set, e.g. when read
+// from a config file. The returned method has been validated.
+func ParseOutgoingMethod(name string, options map[string]interface{}) (OutgoingMethod, error) {
+	if ok, _ := regexp.MatchString(OUTGOING_METHOD_OPTIONS_REGEXP, name); !ok {
+		return nil, fmt.Errorf("%w: invalid outgoing method %q", ErrValidation, name)
+	}
+
+	var m OutgoingMethod
+	switch name {
+	case OUTGOING_METHOD_TURRET_IO_NAME:
+		if len(options) > 0 {
+			return nil, fmt.Errorf("%w: Turret.IO outgoing method does not take options", ErrValidation)
+		}
+		m = TurretIOMethod{}
+	case OUTGOING_METHOD_AWS_NAME:
+		m = AWSSESMethod{
+			AccessKey: optionString(options, AWS_ACCESS_KEY_NAME),
+			SecretKey: optionString(options, AWS_SECRET_ACCESS_KEY_NAME),
+			Region:    optionString(options, AWS_REGION_NAME),
+		}
+	case OUTGOING_METHOD_SMTP_NAME:
+		port := 0
+		if p := optionString(options, SMTP_PORT_NAME); p != "" {
+			var err error
+			if port, err = strconv.Atoi(p); err != nil {
+				return nil, fmt.Errorf("%w: invalid smtp port %q", ErrValidation, p)
+			}
+		}
+		m = SMTPMethod{
+			Host:     optionString(options, SMTP_HOST_NAME),
+			Port:     port,
+			Username: optionString(options, SMTP_USERNAME_NAME),
+			Password: optionString(options, SMTP_PASSWORD_NAME),
+			TLSMode:  SMTPTLSMode(optionString(options, SMTP_TLS_MODE_NAME)),
+		}
+	}
+
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func optionString(options map[string]interface{}, name string) string {
+	switch v := options[name].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
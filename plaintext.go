@@ -0,0 +1,235 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// WithDerivedPlain makes TargetEmail.Create and Update derive the plain text
+// body from the HTML body with HTMLToText when plain_body is empty. The
+// derived text is returned in TargetEmailRecord.DerivedPlain.
+func WithDerivedPlain() TargetEmailOption {
+	return func(te *TargetEmail) {
+		te.derivePlain = true
+	}
+}
+
+// HTMLToText returns a readable plain text version of an HTML email. Links
+// become numbered footnotes, list items are bulleted or numbered, headings
+// are underlined and table rows become lines with cells separated by " | ".
+// Scripts, styles and comments are dropped and placeholders are kept.
+func HTMLToText(html_body string) string {
+	c := &textConverter{atLineStart: true}
+	scanHTML(html_body, func(tok htmlToken) {
+		switch tok.kind {
+		case htmlText:
+			c.text(tok.text)
+		case htmlStartTag:
+			c.start(tok.name, tok.attrs)
+		case htmlEndTag:
+			c.end(tok.name)
+		}
+	})
+	return c.finish()
+}
+
+type textList struct {
+	ordered bool
+	items   int
+}
+
+// textConverter accumulates the text of HTMLToText, collapsing whitespace
+// outside <pre> and only writing separators once text follows them
+type textConverter struct {
+	out         strings.Builder
+	atLineStart bool
+	newlines    int
+	space       bool
+	cellSep     bool
+	pre         int
+	lists       []textList
+	href        string
+	linkStart   int
+	headings    []int
+	footnotes   []string
+}
+
+func (c *textConverter) flush() {
+	if c.out.Len() > 0 && c.newlines > 0 {
+		c.out.WriteString(strings.Repeat("\n", c.newlines))
+		c.atLineStart = true
+	} else if c.cellSep && !c.atLineStart {
+		c.out.WriteString(" | ")
+	} else if c.space && !c.atLineStart {
+		c.out.WriteByte(' ')
+	}
+	c.newlines, c.space, c.cellSep = 0, false, false
+}
+
+// raw writes s as is, after any pending separator
+func (c *textConverter) raw(s string) {
+	c.flush()
+	c.out.WriteString(s)
+	c.atLineStart = strings.HasSuffix(s, "\n")
+}
+
+func (c *textConverter) text(s string) {
+	if c.pre > 0 {
+		c.raw(s)
+		return
+	}
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			c.space = true
+			continue
+		}
+		c.flush()
+		c.out.WriteRune(r)
+		c.atLineStart = false
+	}
+}
+
+// block ends the current line and leaves n-1 blank lines before the next text
+func (c *textConverter) block(n int) {
+	if n > c.newlines {
+		c.newlines = n
+	}
+}
+
+func (c *textConverter) start(name string, attrs string) {
+	switch name {
+	case "br":
+		c.newlines++
+	case "p", "div", "blockquote", "table", "section", "article", "header", "footer":
+		c.block(2)
+	case "tr", "dt", "dd":
+		c.block(1)
+	case "td", "th":
+		c.cellSep = c.newlines == 0 && !c.atLineStart
+	case "hr":
+		c.block(2)
+		c.raw("----------")
+		c.block(2)
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		c.block(2)
+		c.flush()
+		c.headings = append(c.headings, c.out.Len())
+	case "ul", "ol":
+		if len(c.lists) == 0 {
+			c.block(2)
+		}
+		c.lists = append(c.lists, textList{ordered: name == "ol"})
+	case "li":
+		c.block(1)
+		prefix := "* "
+		if len(c.lists) > 0 {
+			l := &c.lists[len(c.lists)-1]
+			l.items++
+			if l.ordered {
+				prefix = fmt.Sprintf("%d. ", l.items)
+			}
+		}
+		indent := 0
+		if len(c.lists) > 1 {
+			indent = 2 * (len(c.lists) - 1)
+		}
+		c.raw(strings.Repeat(" ", indent) + prefix)
+	case "pre":
+		c.block(2)
+		c.pre++
+	case "img":
+		if alt := strings.TrimSpace(htmlAttributes(attrs)["alt"]); alt != "" {
+			c.text(alt)
+		}
+	case "a":
+		c.href = strings.TrimSpace(htmlAttributes(attrs)["href"])
+		c.flush()
+		c.linkStart = c.out.Len()
+	}
+}
+
+func (c *textConverter) end(name string) {
+	switch name {
+	case "p", "div", "blockquote", "table", "section", "article", "header", "footer", "pre":
+		if name == "pre" && c.pre > 0 {
+			c.pre--
+		}
+		c.block(2)
+	case "tr", "li", "dt", "dd":
+		c.block(1)
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		if len(c.headings) == 0 {
+			break
+		}
+		start := c.headings[len(c.headings)-1]
+		c.headings = c.headings[:len(c.headings)-1]
+		heading := strings.TrimSpace(c.out.String()[start:])
+		if heading != "" {
+			underline := "-"
+			if name == "h1" {
+				underline = "="
+			}
+			c.block(1)
+			c.raw(strings.Repeat(underline, utf8.RuneCountInString(heading)))
+		}
+		c.block(2)
+	case "ul", "ol":
+		if len(c.lists) > 0 {
+			c.lists = c.lists[:len(c.lists)-1]
+		}
+		if len(c.lists) == 0 {
+			c.block(2)
+		} else {
+			c.block(1)
+		}
+	case "a":
+		href := c.href
+		c.href = ""
+		label := strings.TrimSpace(c.out.String()[c.linkStart:])
+		switch {
+		case href == "", strings.HasPrefix(href, "#"), strings.HasPrefix(strings.ToLower(href), "javascript:"):
+		case label == "":
+			c.text(href)
+		case label == href || "mailto:"+label == href:
+		default:
+			c.footnotes = append(c.footnotes, href)
+			c.out.WriteString(fmt.Sprintf(" [%d]", len(c.footnotes)))
+			c.atLineStart = false
+		}
+	}
+}
+
+func (c *textConverter) finish() string {
+	lines := strings.Split(c.out.String(), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRightFunc(l, unicode.IsSpace)
+	}
+	text := strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+	if len(c.footnotes) > 0 {
+		text += "\n\n"
+		for i, href := range c.footnotes {
+			text += fmt.Sprintf("[%d] %s\n", i+1, href)
+		}
+		text = strings.TrimSuffix(text, "\n")
+	}
+	return text
+}
@@ -0,0 +1,274 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resource names used to select per-resource rate limiters
+const RESOURCE_USER = "user"
+const RESOURCE_TARGET = "target"
+const RESOURCE_TARGET_EMAIL = "target_email"
+const RESOURCE_ACCOUNT = "account"
+
+// RATE_LIMIT_SEND selects the limiter applied to TargetEmail.Send and
+// TargetEmail.SendTest, in addition to the RESOURCE_TARGET_EMAIL one
+const RATE_LIMIT_SEND = "send"
+
+// RateLimiter is a token bucket shared by every call made through the
+// TurretIO instances it is configured on
+type RateLimiter struct {
+	mu          sync.Mutex
+	rate        float64
+	burst       float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+}
+
+// NewRateLimiter allows requests_per_second calls on average, with bursts of
+// up to burst calls. It returns an ErrValidation unless requests_per_second
+// is positive and finite.
+func NewRateLimiter(requests_per_second float64, burst int) (*RateLimiter, error) {
+	if !(requests_per_second > 0) || math.IsInf(requests_per_second, 1) {
+		return nil, fmt.Errorf("%w: rate limit of %v requests per second, must be positive", ErrValidation, requests_per_second)
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:   requests_per_second,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}, nil
+}
+
+// WithRateLimiter throttles every call made by the TurretIO instance
+func WithRateLimiter(limiter *RateLimiter) Option {
+	return WithResourceRateLimiter("", limiter)
+}
+
+// WithResourceRateLimiter throttles calls to one resource, one of the
+// RESOURCE_* constants or RATE_LIMIT_SEND. Calls also wait on the limiter
+// set with WithRateLimiter, if any.
+func WithResourceRateLimiter(resource string, limiter *RateLimiter) Option {
+	return func(t *TurretIO) {
+		if t.rateLimiters == nil {
+			t.rateLimiters = make(map[string]*RateLimiter)
+		}
+		t.rateLimiters[resource] = limiter
+	}
+}
+
+type failFastKey struct{}
+
+// WithRateLimitFailFast makes calls made with the returned context fail with
+// ErrRateLimited instead of waiting when a rate limiter has no token left
+func WithRateLimitFailFast(ctx context.Context) context.Context {
+	return context.WithValue(ctx, failFastKey{}, true)
+}
+
+// Allow takes a token if one is available without waiting
+func (l *RateLimiter) Allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.refill(now)
+	if now.Before(l.pausedUntil) || l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// Wait takes a token, blocking until one is available. It fails immediately
+// with ErrRateLimited when the wait would outlast the deadline of ctx or ctx
+// was created by WithRateLimitFailFast.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	for {
+		wait, err := l.reserve(ctx)
+		if err != nil || wait == 0 {
+			return err
+		}
+		if err := sleepContext(ctx, wait); err != nil {
+			l.release()
+			return err
+		}
+		// a pause that began during the sleep sends the call back in line
+		l.mu.Lock()
+		paused := time.Now().Before(l.pausedUntil)
+		l.mu.Unlock()
+		if !paused {
+			return nil
+		}
+		l.release()
+	}
+}
+
+// reserve takes a token and returns how long to wait before using it
+func (l *RateLimiter) reserve(ctx context.Context) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.refill(now)
+	l.tokens--
+	wait := time.Duration(0)
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	// tokens only accrue once the pause is over
+	if paused := l.pausedUntil.Sub(now); paused > 0 {
+		wait += paused
+	}
+
+	failFast, _ := ctx.Value(failFastKey{}).(bool)
+	deadline, hasDeadline := ctx.Deadline()
+	if wait > 0 && (failFast || (hasDeadline && now.Add(wait).After(deadline))) {
+		l.tokens++
+		return 0, fmt.Errorf("%w: client rate limit, next slot in %s", ErrRateLimited, wait)
+	}
+	return wait, nil
+}
+
+// release gives back a token taken by Wait for a call that was not made
+func (l *RateLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens++
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
+
+// PauseUntil stops handing out tokens until t, e.g. when the server reports
+// its quota is exhausted. No tokens accrue during the pause and the saved
+// ones but one are dropped, so that calls resume one at a time at the
+// configured rate instead of in a burst.
+func (l *RateLimiter) PauseUntil(t time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	if t.After(l.pausedUntil) {
+		l.pausedUntil = t
+	}
+	if l.tokens > 1 {
+		l.tokens = 1
+	}
+}
+
+func (l *RateLimiter) refill(now time.Time) {
+	from := l.last
+	if from.Before(l.pausedUntil) {
+		from = l.pausedUntil
+	}
+	if now.After(from) {
+		l.tokens += now.Sub(from).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+}
+
+// resourceForPath classifies a resource path such as USER_RESOURCE_PATH + "/email"
+// into one of the RESOURCE_* constants
+func resourceForPath(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case parts[0] == "user":
+		return RESOURCE_USER
+	case parts[0] == "account":
+		return RESOURCE_ACCOUNT
+	case parts[0] == "target" && len(parts) > 2 && parts[2] == "email":
+		return RESOURCE_TARGET_EMAIL
+	case parts[0] == "target":
+		return RESOURCE_TARGET
+	}
+	return parts[0]
+}
+
+func isSendPath(path string) bool {
+	return strings.HasSuffix(path, "/send") || strings.HasSuffix(path, "/sendTestEmail")
+}
+
+// limitersFor returns the rate limiters applying to a call to path
+func (t *TurretIO) limitersFor(path string) []*RateLimiter {
+	if len(t.rateLimiters) == 0 {
+		return nil
+	}
+	keys := []string{"", resourceForPath(path)}
+	if isSendPath(path) {
+		keys = append(keys, RATE_LIMIT_SEND)
+	}
+	var limiters []*RateLimiter
+	for _, k := range keys {
+		if l, ok := t.rateLimiters[k]; ok {
+			limiters = append(limiters, l)
+		}
+	}
+	return limiters
+}
+
+// waitLimiters takes a token from every limiter. When one fails, the tokens
+// already taken are given back, since the call is not made.
+func waitLimiters(ctx context.Context, limiters []*RateLimiter) error {
+	for i, l := range limiters {
+		if err := l.Wait(ctx); err != nil {
+			for _, taken := range limiters[:i] {
+				taken.release()
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// observeRateLimit pauses limiters when the server reports an exhausted
+// quota, through a 429 or X-RateLimit-Remaining: 0
+func observeRateLimit(limiters []*RateLimiter, status int, header http.Header) {
+	if len(limiters) == 0 || header == nil {
+		return
+	}
+	if status != http.StatusTooManyRequests && header.Get("X-RateLimit-Remaining") != "0" {
+		return
+	}
+
+	var until time.Time
+	if wait, ok := parseRetryAfter(header.Get("Retry-After")); ok {
+		until = time.Now().Add(wait)
+	} else if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		// either a unix timestamp or a number of seconds
+		if reset > 1000000000 {
+			until = time.Unix(reset, 0)
+		} else {
+			until = time.Now().Add(time.Duration(reset) * time.Second)
+		}
+	} else if status == http.StatusTooManyRequests {
+		until = time.Now().Add(time.Second)
+	}
+
+	for _, l := range limiters {
+		l.PauseUntil(until)
+	}
+}
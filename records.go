@@ -0,0 +1,229 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// UserRecord is a user as returned by User.Get and User.Set
+type UserRecord struct {
+	Email      string    `json:"email"`
+	Attributes StringMap `json:"attributes"`
+	Properties StringMap `json:"properties"`
+	// Raw holds the full decoded response, including fields unknown to this package
+	Raw map[string]interface{} `json:"-"`
+}
+
+// TargetRecord is a target as returned by Target.Get, Target.Create and Target.Update
+type TargetRecord struct {
+	Name       string          `json:"name"`
+	Attributes []AttributeRule `json:"attributes"`
+	// Raw holds the full decoded response, including fields unknown to this package
+	Raw map[string]interface{} `json:"-"`
+}
+
+// AttributeRule is one entry of a target's attribute list. Groups built with
+// And and Or have an Op of GROUP_AND or GROUP_OR and their members in Rules.
+type AttributeRule struct {
+	Name  string
+	Op    string
+	Value interface{}
+	Rules []AttributeRule
+}
+
+// MarshalJSON writes groups as {"op": ..., "rules": [...]} and other rules in
+// the {"name": ..., "op": ..., "value": ...} form
+func (r AttributeRule) MarshalJSON() ([]byte, error) {
+	if r.Rules != nil {
+		return json.Marshal(map[string]interface{}{"op": r.Op, "rules": r.Rules})
+	}
+	m := map[string]interface{}{"name": r.Name, "value": r.Value}
+	if r.Op != "" {
+		m["op"] = r.Op
+	}
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON accepts the {"name": ..., "op": ..., "value": ...} form, the
+// {"location": "midwest"} shorthand for an equality rule and the
+// {"op": "or", "rules": [...]} form of groups. An object with a single key is
+// always the shorthand, so attributes may be named name, op or rules. An
+// object with several keys but no name or rules, such as
+// {"location": "midwest", "plan": "pro"}, is decoded as a GROUP_AND of
+// equality rules, sorted by attribute.
+func (r *AttributeRule) UnmarshalJSON(data []byte) error {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	if len(m) == 1 {
+		for k, v := range m {
+			r.Name = k
+			return json.Unmarshal(v, &r.Value)
+		}
+	}
+	if rules, ok := m["rules"]; ok {
+		if err := json.Unmarshal(m["op"], &r.Op); err != nil {
+			return fmt.Errorf("turretIO: cannot decode attribute rule %s", string(data))
+		}
+		return json.Unmarshal(rules, &r.Rules)
+	}
+	if name, ok := m["name"]; ok && json.Unmarshal(name, &r.Name) == nil {
+		if op, ok := m["op"]; ok {
+			if err := json.Unmarshal(op, &r.Op); err != nil {
+				return fmt.Errorf("turretIO: cannot decode op of attribute rule %s: %w", string(data), err)
+			}
+		}
+		if value, ok := m["value"]; ok {
+			return json.Unmarshal(value, &r.Value)
+		}
+		return nil
+	}
+	if len(m) > 1 {
+		names := make([]string, 0, len(m))
+		for k := range m {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		r.Op = GROUP_AND
+		r.Rules = make([]AttributeRule, len(names))
+		for i, k := range names {
+			r.Rules[i].Name = k
+			if err := json.Unmarshal(m[k], &r.Rules[i].Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("turretIO: cannot decode attribute rule %s", string(data))
+}
+
+// TargetEmailRecord is a target email as returned by TargetEmail.Get, TargetEmail.Create and TargetEmail.Update
+type TargetEmailRecord struct {
+	ID      string `json:"id"`
+	Target  string `json:"target"`
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Plain   string `json:"plain"`
+	// DerivedPlain is the plain text body Create or Update derived from the
+	// HTML body with WithDerivedPlain, empty if none was derived
+	DerivedPlain string `json:"-"`
+	// LintIssues holds the warnings found with WithLint
+	LintIssues LintIssues `json:"-"`
+	// Raw holds the full decoded response, including fields unknown to this package
+	Raw map[string]interface{} `json:"-"`
+}
+
+// Content returns the subject and bodies of the email
+func (r *TargetEmailRecord) Content() EmailContent {
+	return EmailContent{Subject: r.Subject, HTML: r.HTML, Plain: r.Plain}
+}
+
+// AccountRecord is an account as returned by Account.Get and Account.Set
+type AccountRecord struct {
+	Email          string             `json:"email"`
+	OutgoingMethod OutgoingMethodInfo `json:"outgoing_method"`
+	// Raw holds the full decoded response, including fields unknown to this package
+	Raw map[string]interface{} `json:"-"`
+}
+
+// OutgoingMethodInfo describes how an account sends email
+type OutgoingMethodInfo struct {
+	// Type is one of OUTGOING_METHOD_TURRET_IO_NAME, OUTGOING_METHOD_AWS_NAME or OUTGOING_METHOD_SMTP_NAME
+	Type    string                 `json:"type"`
+	Options map[string]interface{} `json:"options,omitempty"`
+}
+
+// StringMap decodes a JSON object into strings, formatting numbers and booleans
+type StringMap map[string]string
+
+func (m *StringMap) UnmarshalJSON(data []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*m = make(StringMap, len(raw))
+	for k, v := range raw {
+		switch v := v.(type) {
+		case string:
+			(*m)[k] = v
+		case nil:
+			(*m)[k] = ""
+		default:
+			j, _ := json.Marshal(v)
+			(*m)[k] = string(j)
+		}
+	}
+	return nil
+}
+
+// decodeRecord fills record from the JSON body of resp
+func decodeRecord(resp *TurretIOResponse, record interface{}) error {
+	if resp.JSONBody == nil {
+		return nil
+	}
+	j, err := json.Marshal(resp.JSONBody)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(j, record)
+}
+
+func newUserRecord(resp *TurretIOResponse, email string) (*UserRecord, error) {
+	r := &UserRecord{Raw: resp.JSONBody}
+	if err := decodeRecord(resp, r); err != nil {
+		return nil, err
+	}
+	if r.Email == "" {
+		r.Email = email
+	}
+	return r, nil
+}
+
+func newTargetRecord(resp *TurretIOResponse, target_name string) (*TargetRecord, error) {
+	r := &TargetRecord{Raw: resp.JSONBody}
+	if err := decodeRecord(resp, r); err != nil {
+		return nil, err
+	}
+	if r.Name == "" {
+		r.Name = target_name
+	}
+	return r, nil
+}
+
+func newTargetEmailRecord(resp *TurretIOResponse, target_name string, email_id string) (*TargetEmailRecord, error) {
+	r := &TargetEmailRecord{Raw: resp.JSONBody}
+	if err := decodeRecord(resp, r); err != nil {
+		return nil, err
+	}
+	if r.Target == "" {
+		r.Target = target_name
+	}
+	if r.ID == "" {
+		r.ID = email_id
+	}
+	return r, nil
+}
+
+func newAccountRecord(resp *TurretIOResponse) (*AccountRecord, error) {
+	r := &AccountRecord{Raw: resp.JSONBody}
+	if err := decodeRecord(resp, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
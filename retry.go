@@ -0,0 +1,215 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how TurretIO retries failed requests. Every attempt is
+// signed again with a fresh X-Ls-Time timestamp.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	// Values below 2 disable retries.
+	MaxAttempts int
+	// InitialBackoff is the wait before the second attempt
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between attempts
+	MaxBackoff time.Duration
+	// Multiplier grows the backoff after every attempt
+	Multiplier float64
+	// Jitter randomizes each wait by up to this fraction of it (0 to 1)
+	Jitter float64
+	// RetryableStatusCodes lists the HTTP status codes worth retrying.
+	// Transport errors such as connection resets are always retried, unless
+	// a 2xx status was received before them.
+	RetryableStatusCodes []int
+	// HonorRetryAfter waits for the duration given in a Retry-After header
+	// instead of the computed backoff when the server sends one
+	HonorRetryAfter bool
+	// RetryNonIdempotent allows retrying calls that may have side effects
+	// when repeated, such as TargetEmail.Send
+	RetryNonIdempotent bool
+}
+
+// DefaultRetryPolicy returns a policy making up to 4 attempts with exponential
+// backoff starting at 500ms, retrying 429 and 5xx gateway errors
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		RetryableStatusCodes: []int{
+			http.StatusTooManyRequests,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+		HonorRetryAfter: true,
+	}
+}
+
+// WithRetryPolicy enables retries. Without it every call makes a single attempt.
+func WithRetryPolicy(policy *RetryPolicy) Option {
+	return func(t *TurretIO) {
+		t.retryPolicy = policy
+	}
+}
+
+// Backoff returns the wait before the attempt following attempt number attempt, jitter included
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	d := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// shouldRetry decides whether err, returned by attempt number attempt, is
+// worth another try and how long to wait before it
+func (p *RetryPolicy) shouldRetry(ctx context.Context, attempt int, idempotent bool, err error) (time.Duration, bool) {
+	if p == nil || attempt >= p.MaxAttempts || ctx.Err() != nil {
+		return 0, false
+	}
+	if !idempotent && !p.RetryNonIdempotent {
+		return 0, false
+	}
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		if !isTransportError(err) {
+			return 0, false
+		}
+		return p.Backoff(attempt), true
+	}
+	if !p.isRetryableStatus(apiErr.StatusCode) {
+		return 0, false
+	}
+	if p.HonorRetryAfter {
+		if wait, ok := parseRetryAfter(apiErr.Header.Get("Retry-After")); ok {
+			if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+				wait = p.MaxBackoff
+			}
+			return wait, true
+		}
+	}
+	return p.Backoff(attempt), true
+}
+
+// isTransportError reports whether err is a network failure, such as a
+// connection reset or refused, after which the request may be sent again.
+// Errors signing or encoding the request or decoding the response are not,
+// nor are failures reading the body of a 2xx response, since the server
+// handled the call.
+func isTransportError(err error) bool {
+	var received *responseError
+	if errors.As(err, &received) {
+		return false
+	}
+	// *url.Error, returned by http.Client.Do, is a net.Error whatever it
+	// wraps. An io.EOF in it means the connection closed before the response.
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		if errors.Is(urlErr.Err, io.EOF) {
+			return true
+		}
+		err = urlErr.Err
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// responseError is an error reading a response whose 2xx status was received
+type responseError struct {
+	err error
+}
+
+func (e *responseError) Error() string {
+	return e.err.Error()
+}
+
+func (e *responseError) Unwrap() error {
+	return e.err
+}
+
+func (p *RetryPolicy) isRetryableStatus(code int) bool {
+	for _, c := range p.RetryableStatusCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRetryAfter reads a Retry-After header given either in seconds or as an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		wait := time.Until(at)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type nonIdempotentKey struct{}
+
+// withNonIdempotent marks the calls made with ctx as unsafe to repeat
+func withNonIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, nonIdempotentKey{}, true)
+}
+
+func isIdempotent(ctx context.Context) bool {
+	nonIdempotent, _ := ctx.Value(nonIdempotentKey{}).(bool)
+	return !nonIdempotent
+}
@@ -0,0 +1,139 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NewTargetRecord builds a target locally from rules, for use with
+// MatchingTargets without fetching it first
+func NewTargetRecord(target_name string, rules ...TargetRule) (*TargetRecord, error) {
+	list, err := AttributeList(rules...)
+	if err != nil {
+		return nil, err
+	}
+	j, err := json.Marshal(list)
+	if err != nil {
+		return nil, err
+	}
+	r := &TargetRecord{Name: target_name}
+	if err := json.Unmarshal(j, &r.Attributes); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// MatchingTargets returns the targets a user with the given attributes is
+// classified into, in the order of targets. It predicts what User.Set does
+// without calling the API.
+func MatchingTargets(targets []*TargetRecord, attributes map[string]string) ([]*TargetRecord, error) {
+	var matching []*TargetRecord
+	for _, t := range targets {
+		ok, err := t.Matches(attributes)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matching = append(matching, t)
+		}
+	}
+	return matching, nil
+}
+
+// Matches reports whether a user with the given attributes belongs to the
+// target, which is when all of its rules match. Targets without rules match
+// nobody.
+func (r *TargetRecord) Matches(attributes map[string]string) (bool, error) {
+	if len(r.Attributes) == 0 {
+		return false, nil
+	}
+	for _, rule := range r.Attributes {
+		ok, err := rule.Matches(attributes)
+		if err != nil {
+			return false, fmt.Errorf("target %s: %w", r.Name, err)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Matches reports whether a user with the given attributes matches the rule.
+// A missing attribute only matches CONDITION_NOT_EQUALS. Values are compared
+// as numbers when both sides are numeric and as strings otherwise.
+func (r AttributeRule) Matches(attributes map[string]string) (bool, error) {
+	switch r.Op {
+	case GROUP_AND, GROUP_OR:
+		if r.Rules == nil {
+			break
+		}
+		for _, child := range r.Rules {
+			ok, err := child.Matches(attributes)
+			if err != nil {
+				return false, err
+			}
+			if ok == (r.Op == GROUP_OR) {
+				return ok, nil
+			}
+		}
+		return r.Op == GROUP_AND, nil
+	}
+
+	actual, present := attributes[r.Name]
+	switch r.Op {
+	case "", CONDITION_EQUALS:
+		return present && valuesEqual(actual, r.Value), nil
+	case CONDITION_NOT_EQUALS:
+		return !present || !valuesEqual(actual, r.Value), nil
+	case CONDITION_GREATER_THAN:
+		want, ok := numericValue(r.Value)
+		if !ok {
+			return false, fmt.Errorf("%w: %s %s needs a number, got %#v", ErrValidation, r.Name, r.Op, r.Value)
+		}
+		got, ok := numericValue(actual)
+		return present && ok && got > want, nil
+	case CONDITION_CONTAINS:
+		want, ok := r.Value.(string)
+		if !ok {
+			return false, fmt.Errorf("%w: %s %s needs a string, got %#v", ErrValidation, r.Name, r.Op, r.Value)
+		}
+		return present && strings.Contains(actual, want), nil
+	}
+	return false, fmt.Errorf("%w: unknown condition %q on %s", ErrValidation, r.Op, r.Name)
+}
+
+// valuesEqual compares an attribute with a rule value decoded from JSON, as
+// numbers first so that "10.0" equals both 10 and "10"
+func valuesEqual(actual string, value interface{}) bool {
+	if got, ok := numericValue(actual); ok {
+		if want, ok := numericValue(value); ok && got == want {
+			return true
+		}
+	}
+	switch v := value.(type) {
+	case string:
+		return actual == v
+	case bool:
+		return actual == strconv.FormatBool(v)
+	case nil:
+		return actual == ""
+	}
+	return false
+}
@@ -0,0 +1,250 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const CONDITION_EQUALS = "eq"
+const CONDITION_NOT_EQUALS = "ne"
+const CONDITION_GREATER_THAN = "gt"
+const CONDITION_CONTAINS = "contains"
+const GROUP_AND = "and"
+const GROUP_OR = "or"
+
+// TargetRule is one entry of a target's attribute list, either a Condition,
+// a RuleGroup or an AttributeRule read back from the API. The entries of an
+// attribute list must all match.
+type TargetRule interface {
+	// Validate checks the rule locally, errors wrap ErrValidation
+	Validate() error
+	attributeRule() map[string]interface{}
+}
+
+// Condition compares a user attribute with a value
+type Condition struct {
+	Attribute string
+	// Op is one of CONDITION_EQUALS, CONDITION_NOT_EQUALS, CONDITION_GREATER_THAN or CONDITION_CONTAINS
+	Op    string
+	Value interface{}
+}
+
+// Equals matches users whose attribute is value
+func Equals(attribute string, value interface{}) Condition {
+	return Condition{Attribute: attribute, Op: CONDITION_EQUALS, Value: value}
+}
+
+// NotEquals matches users whose attribute is not value
+func NotEquals(attribute string, value interface{}) Condition {
+	return Condition{Attribute: attribute, Op: CONDITION_NOT_EQUALS, Value: value}
+}
+
+// GreaterThan matches users whose attribute is a number greater than value
+func GreaterThan(attribute string, value interface{}) Condition {
+	return Condition{Attribute: attribute, Op: CONDITION_GREATER_THAN, Value: value}
+}
+
+// Contains matches users whose attribute contains the string value
+func Contains(attribute string, value string) Condition {
+	return Condition{Attribute: attribute, Op: CONDITION_CONTAINS, Value: value}
+}
+
+func (c Condition) Validate() error {
+	if c.Attribute == "" {
+		return fmt.Errorf("%w: condition without attribute", ErrValidation)
+	}
+	switch c.Op {
+	case CONDITION_EQUALS, CONDITION_NOT_EQUALS:
+		switch c.Value.(type) {
+		case string, bool:
+			return nil
+		}
+		if _, ok := numericValue(c.Value); !ok {
+			return fmt.Errorf("%w: %s %s needs a string, number or boolean, got %T", ErrValidation, c.Attribute, c.Op, c.Value)
+		}
+	case CONDITION_GREATER_THAN:
+		if _, ok := numericValue(c.Value); !ok {
+			return fmt.Errorf("%w: %s %s needs a number, got %#v", ErrValidation, c.Attribute, c.Op, c.Value)
+		}
+	case CONDITION_CONTAINS:
+		if s, ok := c.Value.(string); !ok || s == "" {
+			return fmt.Errorf("%w: %s %s needs a non-empty string, got %#v", ErrValidation, c.Attribute, c.Op, c.Value)
+		}
+	default:
+		return fmt.Errorf("%w: unknown condition %q on %s", ErrValidation, c.Op, c.Attribute)
+	}
+	return nil
+}
+
+// attributeRule uses the {"location": "midwest"} shorthand for equality, as
+// existing targets do, and the {"name", "op", "value"} form otherwise
+func (c Condition) attributeRule() map[string]interface{} {
+	if c.Op == CONDITION_EQUALS {
+		return map[string]interface{}{c.Attribute: c.Value}
+	}
+	return map[string]interface{}{"name": c.Attribute, "op": c.Op, "value": c.Value}
+}
+
+// RuleGroup combines rules with GROUP_AND or GROUP_OR
+type RuleGroup struct {
+	Op    string
+	Rules []TargetRule
+}
+
+// And matches users matching all of rules
+func And(rules ...TargetRule) RuleGroup {
+	return RuleGroup{Op: GROUP_AND, Rules: rules}
+}
+
+// Or matches users matching any of rules
+func Or(rules ...TargetRule) RuleGroup {
+	return RuleGroup{Op: GROUP_OR, Rules: rules}
+}
+
+func (g RuleGroup) Validate() error {
+	if g.Op != GROUP_AND && g.Op != GROUP_OR {
+		return fmt.Errorf("%w: unknown rule group %q", ErrValidation, g.Op)
+	}
+	if len(g.Rules) == 0 {
+		return fmt.Errorf("%w: empty %s group", ErrValidation, g.Op)
+	}
+	for _, r := range g.Rules {
+		if r == nil {
+			return fmt.Errorf("%w: nil rule in %s group", ErrValidation, g.Op)
+		}
+		if err := r.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g RuleGroup) attributeRule() map[string]interface{} {
+	rules := make([]map[string]interface{}, len(g.Rules))
+	for i, r := range g.Rules {
+		rules[i] = r.attributeRule()
+	}
+	return map[string]interface{}{"op": g.Op, "rules": rules}
+}
+
+// AttributeList validates rules and returns them as the attribute_list taken
+// by Target.Create and Target.Update.
+// Example:
+// list, err := AttributeList(Equals("location", "west coast"), Or(GreaterThan("logins", 10), Equals("premium", "1")))
+func AttributeList(rules ...TargetRule) ([]map[string]interface{}, error) {
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("%w: target without rules", ErrValidation)
+	}
+	list := make([]map[string]interface{}, len(rules))
+	for i, r := range rules {
+		if r == nil {
+			return nil, fmt.Errorf("%w: nil rule", ErrValidation)
+		}
+		if err := r.Validate(); err != nil {
+			return nil, err
+		}
+		list[i] = r.attributeRule()
+	}
+	return list, nil
+}
+
+// numericValue returns v as a float64 if it is a number or a string holding one
+func numericValue(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// Validate checks a rule decoded from JSON like the Condition or RuleGroup it stands for
+func (r AttributeRule) Validate() error {
+	if r.Rules != nil {
+		rules := make([]TargetRule, len(r.Rules))
+		for i, child := range r.Rules {
+			rules[i] = child
+		}
+		return RuleGroup{Op: r.Op, Rules: rules}.Validate()
+	}
+	op := r.Op
+	if op == "" {
+		op = CONDITION_EQUALS
+	}
+	return Condition{Attribute: r.Name, Op: op, Value: r.Value}.Validate()
+}
+
+func (r AttributeRule) attributeRule() map[string]interface{} {
+	if r.Rules != nil {
+		rules := make([]map[string]interface{}, len(r.Rules))
+		for i, child := range r.Rules {
+			rules[i] = child.attributeRule()
+		}
+		return map[string]interface{}{"op": r.Op, "rules": rules}
+	}
+	op := r.Op
+	if op == "" {
+		op = CONDITION_EQUALS
+	}
+	return Condition{Attribute: r.Name, Op: op, Value: r.Value}.attributeRule()
+}
+
+// String writes the rule as an expression such as (logins > 10 OR plan != "free")
+func (r AttributeRule) String() string {
+	if r.Rules != nil {
+		parts := make([]string, len(r.Rules))
+		for i, child := range r.Rules {
+			parts[i] = child.String()
+		}
+		return "(" + strings.Join(parts, " "+strings.ToUpper(r.Op)+" ") + ")"
+	}
+	value, _ := json.Marshal(r.Value)
+	op := map[string]string{"": "=", CONDITION_EQUALS: "=", CONDITION_NOT_EQUALS: "!=", CONDITION_GREATER_THAN: ">"}[r.Op]
+	if op == "" {
+		op = r.Op
+	}
+	return fmt.Sprintf("%s %s %s", r.Name, op, value)
+}
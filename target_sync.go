@@ -0,0 +1,267 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const TARGET_CREATE = "create"
+const TARGET_UPDATE = "update"
+const TARGET_UNCHANGED = "unchanged"
+
+// ErrDestructiveChange is returned by TargetSync.Apply when the plan updates
+// existing targets and destructive changes were not allowed
+var ErrDestructiveChange = errors.New("turretIO: plan changes existing targets")
+
+// TargetDefinition is the desired state of a target
+type TargetDefinition struct {
+	Name       string          `json:"name"`
+	Attributes []AttributeRule `json:"attributes"`
+}
+
+// LoadTargetDefinitions reads and validates target definitions from JSON of the form
+//
+//	{"targets": [{"name": "midwest", "attributes": [{"location": "midwest"}, {"op": "or", "rules": [...]}]}]}
+//
+// where attributes use the attribute list forms of AttributeRule
+func LoadTargetDefinitions(r io.Reader) ([]TargetDefinition, error) {
+	var file struct {
+		Targets []TargetDefinition `json:"targets"`
+	}
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("%w: reading target definitions: %s", ErrValidation, err)
+	}
+	seen := make(map[string]bool)
+	for _, def := range file.Targets {
+		if def.Name == "" {
+			return nil, fmt.Errorf("%w: target without name", ErrValidation)
+		}
+		if seen[def.Name] {
+			return nil, fmt.Errorf("%w: target %s defined twice", ErrValidation, def.Name)
+		}
+		seen[def.Name] = true
+		if len(def.Attributes) == 0 {
+			return nil, fmt.Errorf("%w: target %s has no attributes", ErrValidation, def.Name)
+		}
+		for _, rule := range def.Attributes {
+			if err := rule.Validate(); err != nil {
+				return nil, fmt.Errorf("target %s: %w", def.Name, err)
+			}
+		}
+	}
+	return file.Targets, nil
+}
+
+// TargetChange is what applying a plan does to one target
+type TargetChange struct {
+	Definition TargetDefinition
+	// Action is TARGET_CREATE, TARGET_UPDATE or TARGET_UNCHANGED
+	Action string
+	// Current is the target as returned by Target.Get, nil if it does not exist
+	Current *TargetRecord
+	// Removed and Added are the rules only found in Current and in Definition
+	Removed []AttributeRule
+	Added   []AttributeRule
+}
+
+// Destructive reports whether the change replaces the rules of an existing
+// target, which moves users in or out of it and changes who its emails reach
+func (c TargetChange) Destructive() bool {
+	return c.Action == TARGET_UPDATE
+}
+
+// TargetPlan lists the changes needed to bring Turret.IO in line with a set of definitions
+type TargetPlan struct {
+	Changes []TargetChange
+}
+
+// Count returns the number of changes with the given action
+func (p *TargetPlan) Count(action string) int {
+	n := 0
+	for _, c := range p.Changes {
+		if c.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// Destructive returns the changes that need confirmation to be applied
+func (p *TargetPlan) Destructive() []TargetChange {
+	var changes []TargetChange
+	for _, c := range p.Changes {
+		if c.Destructive() {
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+// String describes the plan, listing the rules each change removes and adds
+func (p *TargetPlan) String() string {
+	var b strings.Builder
+	for _, c := range p.Changes {
+		switch c.Action {
+		case TARGET_CREATE:
+			fmt.Fprintf(&b, "+ %s\n", c.Definition.Name)
+			for _, r := range c.Added {
+				fmt.Fprintf(&b, "    + %s\n", r)
+			}
+		case TARGET_UPDATE:
+			fmt.Fprintf(&b, "~ %s (destructive)\n", c.Definition.Name)
+			for _, r := range c.Removed {
+				fmt.Fprintf(&b, "    - %s\n", r)
+			}
+			for _, r := range c.Added {
+				fmt.Fprintf(&b, "    + %s\n", r)
+			}
+		}
+	}
+	fmt.Fprintf(&b, "%d to create, %d to update, %d unchanged\n", p.Count(TARGET_CREATE), p.Count(TARGET_UPDATE), p.Count(TARGET_UNCHANGED))
+	return b.String()
+}
+
+// TargetSync creates and updates targets from definitions
+type TargetSync struct {
+	Target *Target
+}
+
+// NewTargetSync creates a TargetSync using t
+func NewTargetSync(t *Target) *TargetSync {
+	return &TargetSync{Target: t}
+}
+
+// PlanContext compares defs with the targets returned by Target.Get
+func (s *TargetSync) PlanContext(ctx context.Context, defs []TargetDefinition) (*TargetPlan, error) {
+	plan := &TargetPlan{}
+	for _, def := range defs {
+		change := TargetChange{Definition: def}
+		current, err := s.Target.GetContext(ctx, def.Name)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			change.Action = TARGET_CREATE
+			change.Added = def.Attributes
+		case err != nil:
+			return nil, fmt.Errorf("target %s: %w", def.Name, err)
+		default:
+			change.Current = current
+			change.Removed, change.Added = diffRules(current.Attributes, def.Attributes)
+			change.Action = TARGET_UNCHANGED
+			if len(change.Removed) > 0 || len(change.Added) > 0 {
+				change.Action = TARGET_UPDATE
+			}
+		}
+		plan.Changes = append(plan.Changes, change)
+	}
+	return plan, nil
+}
+
+// Plan works like PlanContext using context.Background()
+func (s *TargetSync) Plan(defs []TargetDefinition) (*TargetPlan, error) {
+	return s.PlanContext(context.Background(), defs)
+}
+
+// ApplyContext creates and updates the targets of plan, in order, and returns
+// the resulting records. Unless allow_destructive is set it returns
+// ErrDestructiveChange, before any call, if the plan has destructive changes.
+func (s *TargetSync) ApplyContext(ctx context.Context, plan *TargetPlan, allow_destructive bool) ([]*TargetRecord, error) {
+	if destructive := plan.Destructive(); len(destructive) > 0 && !allow_destructive {
+		names := make([]string, len(destructive))
+		for i, c := range destructive {
+			names[i] = c.Definition.Name
+		}
+		return nil, fmt.Errorf("%w: %s", ErrDestructiveChange, strings.Join(names, ", "))
+	}
+
+	var applied []*TargetRecord
+	for _, c := range plan.Changes {
+		if c.Action == TARGET_UNCHANGED {
+			continue
+		}
+		rules := make([]TargetRule, len(c.Definition.Attributes))
+		for i, r := range c.Definition.Attributes {
+			rules[i] = r
+		}
+		list, err := AttributeList(rules...)
+		if err != nil {
+			return applied, fmt.Errorf("target %s: %w", c.Definition.Name, err)
+		}
+		var r *TargetRecord
+		if c.Action == TARGET_CREATE {
+			r, err = s.Target.CreateContext(ctx, c.Definition.Name, list)
+		} else {
+			r, err = s.Target.UpdateContext(ctx, c.Definition.Name, list)
+		}
+		if err != nil {
+			return applied, fmt.Errorf("target %s: %w", c.Definition.Name, err)
+		}
+		applied = append(applied, r)
+	}
+	return applied, nil
+}
+
+// Apply works like ApplyContext using context.Background()
+func (s *TargetSync) Apply(plan *TargetPlan, allow_destructive bool) ([]*TargetRecord, error) {
+	return s.ApplyContext(context.Background(), plan, allow_destructive)
+}
+
+// diffRules compares two attribute lists, in which order does not matter
+func diffRules(current []AttributeRule, desired []AttributeRule) (removed []AttributeRule, added []AttributeRule) {
+	count := make(map[string]int)
+	for _, r := range desired {
+		count[ruleKey(r)]++
+	}
+	for _, r := range current {
+		if count[ruleKey(r)] > 0 {
+			count[ruleKey(r)]--
+		} else {
+			removed = append(removed, r)
+		}
+	}
+	for _, r := range desired {
+		if count[ruleKey(r)] > 0 {
+			count[ruleKey(r)]--
+			added = append(added, r)
+		}
+	}
+	return removed, added
+}
+
+// ruleKey identifies a rule for diffRules. Numbers and strings holding them,
+// which the API may return in place of one another, share a key, and so do
+// groups listing the same rules in a different order.
+func ruleKey(r AttributeRule) string {
+	if r.Rules != nil {
+		parts := make([]string, len(r.Rules))
+		for i, child := range r.Rules {
+			parts[i] = ruleKey(child)
+		}
+		sort.Strings(parts)
+		return "(" + strings.Join(parts, " "+strings.ToUpper(r.Op)+" ") + ")"
+	}
+	if f, ok := numericValue(r.Value); ok {
+		r.Value = f
+	}
+	return r.String()
+}
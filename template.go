@@ -0,0 +1,231 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+const PLACEHOLDER_OPEN = "{{"
+const PLACEHOLDER_CLOSE = "}}"
+const PLACEHOLDER_NAME_REGEXP = "^[A-Za-z_][A-Za-z0-9_.-]*$"
+
+// PLACEHOLDER_EMAIL is filled with the user's email address rather than a property
+const PLACEHOLDER_EMAIL = "email"
+
+const PLACEHOLDER_MISSING = "missing"
+const PLACEHOLDER_UNKNOWN = "unknown"
+const PLACEHOLDER_MALFORMED = "malformed"
+
+const FIELD_SUBJECT = "subject"
+const FIELD_HTML = "html"
+const FIELD_PLAIN = "plain"
+
+var placeholderName = regexp.MustCompile(PLACEHOLDER_NAME_REGEXP)
+
+// EmailContent is the subject and bodies of a target email
+type EmailContent struct {
+	Subject string
+	HTML    string
+	Plain   string
+}
+
+// PlaceholderProblem is a placeholder that will not render as intended
+type PlaceholderProblem struct {
+	// Field is FIELD_SUBJECT, FIELD_HTML or FIELD_PLAIN
+	Field string
+	// Offset is the byte offset of the placeholder in Field
+	Offset int
+	// Text is the placeholder as written
+	Text string
+	// Name is the property the placeholder refers to, empty if malformed
+	Name string
+	// Kind is PLACEHOLDER_MISSING, PLACEHOLDER_UNKNOWN or PLACEHOLDER_MALFORMED
+	Kind string
+}
+
+func (p PlaceholderProblem) String() string {
+	return fmt.Sprintf("%s placeholder %s in %s at offset %d", p.Kind, p.Text, p.Field, p.Offset)
+}
+
+// TemplateError reports the placeholder problems found in an email
+type TemplateError struct {
+	Problems []PlaceholderProblem
+}
+
+func (e *TemplateError) Error() string {
+	msgs := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		msgs[i] = p.String()
+	}
+	return "turretIO: " + strings.Join(msgs, "; ")
+}
+
+// Is makes errors.Is(err, ErrValidation) match a TemplateError
+func (e *TemplateError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// Renderer renders {{property}} placeholders the way Turret.IO fills them
+// when sending, so emails can be previewed against a sample user
+type Renderer struct {
+	// KnownProperties, when set, lists the properties users may have and
+	// placeholders naming anything else are PLACEHOLDER_UNKNOWN
+	KnownProperties []string
+}
+
+// NewRenderer creates a Renderer accepting the given properties, or any
+// property if none are given
+func NewRenderer(known_properties ...string) *Renderer {
+	return &Renderer{KnownProperties: known_properties}
+}
+
+// WithPlaceholderCheck makes TargetEmail.Create and Update return a
+// *TemplateError, without calling the API, when r finds malformed or unknown
+// placeholders in the content
+func WithPlaceholderCheck(r *Renderer) TargetEmailOption {
+	return func(te *TargetEmail) {
+		te.renderer = r
+	}
+}
+
+// RenderResult is an email rendered for one user
+type RenderResult struct {
+	EmailContent
+	Problems []PlaceholderProblem
+}
+
+// Err returns a *TemplateError listing the problems, or nil if there are none
+func (r *RenderResult) Err() error {
+	if len(r.Problems) == 0 {
+		return nil
+	}
+	return &TemplateError{r.Problems}
+}
+
+// Render fills the placeholders of content with the user's email and
+// property_map. Values are HTML escaped in the HTML body. Placeholders without
+// a value render empty and are reported PLACEHOLDER_MISSING; malformed ones
+// are left as written.
+func (r *Renderer) Render(content EmailContent, email string, property_map map[string]string) *RenderResult {
+	result := &RenderResult{}
+	fill := func(field string, text string, escape bool) string {
+		var out strings.Builder
+		last := 0
+		r.scan(field, text, func(start, end int, name string, problem *PlaceholderProblem) {
+			out.WriteString(text[last:start])
+			last = end
+			if problem != nil {
+				result.Problems = append(result.Problems, *problem)
+				if problem.Kind == PLACEHOLDER_MALFORMED {
+					out.WriteString(text[start:end])
+					return
+				}
+			}
+			value, ok := property_map[name]
+			if name == PLACEHOLDER_EMAIL && email != "" {
+				value, ok = email, true
+			}
+			if !ok && problem == nil {
+				result.Problems = append(result.Problems, PlaceholderProblem{Field: field, Offset: start, Text: text[start:end], Name: name, Kind: PLACEHOLDER_MISSING})
+			}
+			if escape {
+				value = html.EscapeString(value)
+			}
+			out.WriteString(value)
+		})
+		out.WriteString(text[last:])
+		return out.String()
+	}
+	result.Subject = fill(FIELD_SUBJECT, content.Subject, false)
+	result.HTML = fill(FIELD_HTML, content.HTML, true)
+	result.Plain = fill(FIELD_PLAIN, content.Plain, false)
+	return result
+}
+
+// Check returns the malformed and unknown placeholders of content, the
+// problems that do not depend on the user the email is sent to
+func (r *Renderer) Check(content EmailContent) []PlaceholderProblem {
+	var problems []PlaceholderProblem
+	collect := func(start, end int, name string, problem *PlaceholderProblem) {
+		if problem != nil {
+			problems = append(problems, *problem)
+		}
+	}
+	r.scan(FIELD_SUBJECT, content.Subject, collect)
+	r.scan(FIELD_HTML, content.HTML, collect)
+	r.scan(FIELD_PLAIN, content.Plain, collect)
+	return problems
+}
+
+// Placeholders returns the property names used by content, once each
+func (r *Renderer) Placeholders(content EmailContent) []string {
+	var names []string
+	seen := make(map[string]bool)
+	collect := func(start, end int, name string, problem *PlaceholderProblem) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	r.scan(FIELD_SUBJECT, content.Subject, collect)
+	r.scan(FIELD_HTML, content.HTML, collect)
+	r.scan(FIELD_PLAIN, content.Plain, collect)
+	return names
+}
+
+// scan calls fn for every placeholder of text with its bounds, its property
+// name and the problem found with it, if any
+func (r *Renderer) scan(field string, text string, fn func(start, end int, name string, problem *PlaceholderProblem)) {
+	for pos := 0; ; {
+		i := strings.Index(text[pos:], PLACEHOLDER_OPEN)
+		if i < 0 {
+			return
+		}
+		start := pos + i
+		j := strings.Index(text[start+len(PLACEHOLDER_OPEN):], PLACEHOLDER_CLOSE)
+		if j < 0 {
+			fn(start, len(text), "", &PlaceholderProblem{Field: field, Offset: start, Text: text[start:], Kind: PLACEHOLDER_MALFORMED})
+			return
+		}
+		end := start + len(PLACEHOLDER_OPEN) + j + len(PLACEHOLDER_CLOSE)
+		pos = end
+		raw := text[start:end]
+		name := strings.TrimSpace(raw[len(PLACEHOLDER_OPEN) : len(raw)-len(PLACEHOLDER_CLOSE)])
+		switch {
+		case !placeholderName.MatchString(name):
+			fn(start, end, "", &PlaceholderProblem{Field: field, Offset: start, Text: raw, Kind: PLACEHOLDER_MALFORMED})
+		case !r.known(name):
+			fn(start, end, name, &PlaceholderProblem{Field: field, Offset: start, Text: raw, Name: name, Kind: PLACEHOLDER_UNKNOWN})
+		default:
+			fn(start, end, name, nil)
+		}
+	}
+}
+
+func (r *Renderer) known(name string) bool {
+	if len(r.KnownProperties) == 0 || name == PLACEHOLDER_EMAIL {
+		return true
+	}
+	for _, k := range r.KnownProperties {
+		if k == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/turretIO/turret-io-go"
+	"github.com/turretIO/turret-io-go/turretiotest"
+)
+
+func TestUserBatcher(t *testing.T) {
+	srv := turretiotest.NewServer()
+	defer srv.Close()
+	srv.AddCredentials(VALID_API_KEY, VALID_API_SECRET)
+
+	var items []turretIO.UserBatchItem
+	for i := 0; i < 20; i++ {
+		items = append(items, turretIO.UserBatchItem{
+			Email:      fmt.Sprintf("user%d@example.com", i),
+			Attributes: map[string]string{"location": "midwest"},
+		})
+	}
+	// no email, the fake server answers 404
+	items = append(items, turretIO.UserBatchItem{})
+
+	batcher := turretIO.NewUserBatcher(turretIO.NewUser(srv.Client(VALID_API_KEY, VALID_API_SECRET)))
+	batcher.Concurrency = 3
+	progress := 0
+	batcher.OnProgress = func(p turretIO.UserBatchProgress) {
+		progress++
+		if p.Processed != progress {
+			t.Errorf("OnProgress reported %d processed after %d calls", p.Processed, progress)
+		}
+	}
+
+	summary, err := batcher.RunSlice(context.Background(), items)
+	if err != nil {
+		t.Fatalf("UserBatcher error: %s", err)
+	}
+	if summary.Processed != 21 || summary.Succeeded != 20 || summary.Failed != 1 || len(summary.Failures) != 1 {
+		t.Errorf("UserBatcher summary wrong: %+v", summary.UserBatchProgress)
+	}
+	if srv.User("user7@example.com") == nil {
+		t.Errorf("UserBatcher did not upsert users")
+	}
+}
+
+func TestUserBatcherCancel(t *testing.T) {
+	srv := turretiotest.NewServer()
+	defer srv.Close()
+	srv.AddCredentials(VALID_API_KEY, VALID_API_SECRET)
+
+	items := make(chan turretIO.UserBatchItem, 10)
+	for i := 0; i < cap(items); i++ {
+		items <- turretIO.UserBatchItem{Email: fmt.Sprintf("user%d@example.com", i)}
+	}
+	close(items)
+
+	batcher := turretIO.NewUserBatcher(turretIO.NewUser(srv.Client(VALID_API_KEY, VALID_API_SECRET)))
+	batcher.RequestsPerSecond = 2
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	summary, err := batcher.Run(ctx, items)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run should return the context error, got %v", err)
+	}
+	if summary.Processed+len(items) != cap(items) {
+		t.Errorf("Every item taken should be recorded: %d processed, %d left of %d", summary.Processed, len(items), cap(items))
+	}
+	canceled := 0
+	for _, f := range summary.Failures {
+		if errors.Is(f.Err, context.Canceled) {
+			canceled++
+		}
+	}
+	if canceled == 0 || summary.Succeeded+canceled != summary.Processed {
+		t.Errorf("Items taken after cancellation should fail with context.Canceled: %+v", summary.UserBatchProgress)
+	}
+}
+
+func TestUserBatcherCancelAfterCompletion(t *testing.T) {
+	srv := turretiotest.NewServer()
+	defer srv.Close()
+	srv.AddCredentials(VALID_API_KEY, VALID_API_SECRET)
+
+	items := []turretIO.UserBatchItem{{Email: "one@example.com"}, {Email: "two@example.com"}, {Email: "three@example.com"}}
+	batcher := turretIO.NewUserBatcher(turretIO.NewUser(srv.Client(VALID_API_KEY, VALID_API_SECRET)))
+	check := func(name string, run func(ctx context.Context) (*turretIO.UserBatchSummary, error)) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		batcher.OnProgress = func(p turretIO.UserBatchProgress) {
+			if p.Processed == len(items) {
+				cancel()
+			}
+		}
+		summary, err := run(ctx)
+		if err != nil || summary.Succeeded != len(items) {
+			t.Errorf("%s: cancelling after the last item should not fail the run, got %v, %+v", name, err, summary.UserBatchProgress)
+		}
+	}
+
+	check("RunSlice", func(ctx context.Context) (*turretIO.UserBatchSummary, error) {
+		return batcher.RunSlice(ctx, items)
+	})
+	check("Run", func(ctx context.Context) (*turretIO.UserBatchSummary, error) {
+		ch := make(chan turretIO.UserBatchItem, len(items))
+		for _, item := range items {
+			ch <- item
+		}
+		close(ch)
+		return batcher.Run(ctx, ch)
+	})
+}
@@ -0,0 +1,93 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/turretIO/turret-io-go"
+	"github.com/turretIO/turret-io-go/turretiotest"
+)
+
+func TestCassette(t *testing.T) {
+	srv := turretiotest.NewServer()
+	srv.AddCredentials(VALID_API_KEY, VALID_API_SECRET)
+	path := filepath.Join(t.TempDir(), "cassettes", "user.json")
+	aws := turretIO.AWSSESMethod{AccessKey: "AKIDEXAMPLE", SecretKey: "wJalrXUtnFEMI"}
+
+	// exercise makes the same calls when recording and replaying
+	exercise := func(turret *turretIO.TurretIO) {
+		t.Helper()
+		user := turretIO.NewUser(turret)
+		if _, err := user.Set(EMAIL_TEST, map[string]string{"location": "midwest"}, nil); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+		record, err := user.Get(EMAIL_TEST)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		if record.Attributes["location"] != "midwest" {
+			t.Errorf("Unexpected user %+v", record)
+		}
+		if _, err := turretIO.NewAccount(turret).Set(aws); err != nil {
+			t.Fatalf("Account Set failed: %v", err)
+		}
+		if _, err := turretIO.NewTarget(turret).Get(TARGET_NAME); !errors.Is(err, turretIO.ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	}
+
+	recorder := turretiotest.RecordCassette(path, nil)
+	exercise(turretIO.NewTurretIOWithOptions(VALID_API_KEY, VALID_API_SECRET,
+		turretIO.WithBaseURL(srv.URL), turretIO.WithHTTPClient(recorder.Client())))
+	if err := recorder.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	signature := srv.Calls()[0].Header.Get("X-Ls-Auth")
+	srv.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{VALID_API_KEY, signature, "AKIDEXAMPLE", "wJalrXUtnFEMI"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("Cassette should not contain %s", secret)
+		}
+	}
+
+	// the server is gone, responses come from the cassette
+	player, err := turretiotest.LoadCassette(path)
+	if err != nil {
+		t.Fatalf("LoadCassette failed: %v", err)
+	}
+	if n := len(player.Interactions()); n != 4 {
+		t.Fatalf("Expected 4 interactions, got %d", n)
+	}
+	turret := turretIO.NewTurretIOWithOptions(VALID_API_KEY, VALID_API_SECRET,
+		turretIO.WithBaseURL(srv.URL), turretIO.WithHTTPClient(player.Client()))
+	exercise(turret)
+
+	if _, err := turretIO.NewUser(turret).Set(EMAIL_TEST, map[string]string{"location": "east"}, nil); !errors.Is(err, turretiotest.ErrCassetteMiss) {
+		t.Errorf("Unrecorded payload should miss, got %v", err)
+	}
+	if _, err := turretIO.NewUser(turret).Get(EMAIL_TEST); !errors.Is(err, turretiotest.ErrCassetteMiss) {
+		t.Errorf("Interactions should be replayed once, got %v", err)
+	}
+}
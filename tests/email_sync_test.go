@@ -0,0 +1,123 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/turretIO/turret-io-go"
+	"github.com/turretIO/turret-io-go/turretiotest"
+)
+
+func TestEmailSync(t *testing.T) {
+	srv := turretiotest.NewServer()
+	defer srv.Close()
+	srv.AddCredentials(VALID_API_KEY, VALID_API_SECRET)
+	srv.SetTarget(TARGET_NAME, []map[string]interface{}{{"location": "midwest"}})
+	srv.SetTargetEmail(TARGET_NAME, "same", "Same", "<p>Same</p>", "Same")
+	srv.SetTargetEmail(TARGET_NAME, "changed", "Old subject", "<p>Hello</p>\n<p>Old</p>", "Hello")
+
+	fsys := fstest.MapFS{
+		TARGET_NAME + "/same/subject.txt":    {Data: []byte("Same\n")},
+		TARGET_NAME + "/same/body.html":      {Data: []byte("<p>Same</p>\r\n")},
+		TARGET_NAME + "/same/body.txt":       {Data: []byte("Same\n")},
+		TARGET_NAME + "/changed/subject.txt": {Data: []byte("New subject\n")},
+		TARGET_NAME + "/changed/body.html":   {Data: []byte("<p>Hello</p>\n<p>New</p>\n")},
+		TARGET_NAME + "/changed/body.txt":    {Data: []byte("Hello\n")},
+		TARGET_NAME + "/gone/subject.txt":    {Data: []byte("Gone\n")},
+		TARGET_NAME + "/gone/body.html":      {Data: []byte("<p>Gone</p>\n")},
+	}
+	defs, err := turretIO.LoadEmailDefinitions(fsys)
+	if err != nil {
+		t.Fatalf("LoadEmailDefinitions error: %s", err)
+	}
+	if len(defs) != 3 || defs[0].ID != "changed" || defs[0].Subject != "New subject" {
+		t.Fatalf("LoadEmailDefinitions returned %+v", defs)
+	}
+
+	sync := turretIO.NewEmailSync(turretIO.NewTargetEmail(srv.Client(VALID_API_KEY, VALID_API_SECRET)))
+	plan, err := sync.Plan(defs)
+	if err != nil {
+		t.Fatalf("Plan error: %s", err)
+	}
+	if plan.Count(turretIO.SYNC_UPDATE) != 1 || plan.Count(turretIO.SYNC_UNCHANGED) != 1 || plan.Count(turretIO.SYNC_MISSING) != 1 {
+		t.Errorf("Plan wrong:\n%s", plan)
+	}
+	if fields := plan.Changes[0].Fields; len(fields) != 2 || fields[0] != turretIO.FIELD_SUBJECT || fields[1] != turretIO.FIELD_HTML {
+		t.Errorf("Plan found changed fields %v", fields)
+	}
+	out := plan.String()
+	for _, line := range []string{"~ " + TARGET_NAME + "/changed", "    -<p>Old</p>", "    +<p>New</p>", "    -Old subject", "! " + TARGET_NAME + "/gone does not exist"} {
+		if !strings.Contains(out, line) {
+			t.Errorf("Plan output lacks %q:\n%s", line, out)
+		}
+	}
+	if len(srv.CallsTo("POST", "/target/"+TARGET_NAME+"/email/changed")) != 0 {
+		t.Errorf("Plan updated an email")
+	}
+
+	updated, err := sync.Apply(plan)
+	if err != nil {
+		t.Fatalf("Apply error: %s", err)
+	}
+	if len(updated) != 1 || updated[0].Subject != "New subject" {
+		t.Errorf("Apply returned %+v", updated)
+	}
+	if plan, _ := sync.Plan(defs); plan.Count(turretIO.SYNC_UPDATE) != 0 {
+		t.Errorf("Plan after Apply still has updates:\n%s", plan)
+	}
+}
+
+func TestEmailSyncWithoutPlain(t *testing.T) {
+	srv := turretiotest.NewServer()
+	defer srv.Close()
+	srv.AddCredentials(VALID_API_KEY, VALID_API_SECRET)
+	srv.SetTarget(TARGET_NAME, []map[string]interface{}{{"location": "midwest"}})
+	srv.SetTargetEmail(TARGET_NAME, "abc", " Hello ", "<p>Old</p>", "Remote plain")
+
+	defs, err := turretIO.LoadEmailDefinitions(fstest.MapFS{
+		TARGET_NAME + "/abc/subject.txt": {Data: []byte("Hello\n")},
+		TARGET_NAME + "/abc/body.html":   {Data: []byte("<p>New</p>\n")},
+	})
+	if err != nil {
+		t.Fatalf("LoadEmailDefinitions error: %s", err)
+	}
+
+	derived := turretIO.NewEmailSync(turretIO.NewTargetEmail(srv.Client(VALID_API_KEY, VALID_API_SECRET), turretIO.WithDerivedPlain()))
+	plan, err := derived.Plan(defs)
+	if err != nil {
+		t.Fatalf("Plan error: %s", err)
+	}
+	if fields := plan.Changes[0].Fields; len(fields) != 2 || fields[0] != turretIO.FIELD_HTML || fields[1] != turretIO.FIELD_PLAIN {
+		t.Errorf("Plan with a derived plain body found changed fields %v", fields)
+	}
+
+	te := turretIO.NewTargetEmail(srv.Client(VALID_API_KEY, VALID_API_SECRET))
+	plan, err = turretIO.NewEmailSync(te).Plan(defs)
+	if err != nil {
+		t.Fatalf("Plan error: %s", err)
+	}
+	if fields := plan.Changes[0].Fields; len(fields) != 1 || fields[0] != turretIO.FIELD_HTML {
+		t.Errorf("Plan without body.txt found changed fields %v", fields)
+	}
+	if _, err := turretIO.NewEmailSync(te).Apply(plan); err != nil {
+		t.Fatalf("Apply error: %s", err)
+	}
+	if email, err := te.Get(TARGET_NAME, "abc"); err != nil || email.Plain != "Remote plain" || email.HTML != "<p>New</p>" {
+		t.Errorf("Apply without body.txt should keep the plain body, got %+v, %v", email, err)
+	}
+}
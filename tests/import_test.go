@@ -0,0 +1,218 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/turretIO/turret-io-go"
+	"github.com/turretIO/turret-io-go/turretiotest"
+)
+
+const IMPORT_CSV = `email,location,plan,full_name
+one@example.com,midwest,pro,John One
+not-an-email,midwest,pro,Nobody
+two@example.com,eastwest,,Jane Two
+three@example.com,midwest,free,Jim Three
+`
+
+func TestUserImporterCSV(t *testing.T) {
+	srv := turretiotest.NewServer()
+	defer srv.Close()
+	srv.AddCredentials(VALID_API_KEY, VALID_API_SECRET)
+
+	var rejects bytes.Buffer
+	checkpoint := filepath.Join(t.TempDir(), "import.checkpoint")
+	newImporter := func() *turretIO.UserImporter {
+		im := turretIO.NewUserImporter(turretIO.NewUser(srv.Client(VALID_API_KEY, VALID_API_SECRET)))
+		im.Mapping = turretIO.ColumnMapping{Attributes: []string{"location", "plan"}, Properties: []string{"full_name"}}
+		im.Rejects = &rejects
+		im.CheckpointPath = checkpoint
+		return im
+	}
+
+	// interrupt the import once the third row is done
+	ctx, cancel := context.WithCancel(context.Background())
+	im := newImporter()
+	im.OnRow = func(row int, err error) {
+		if row == 3 {
+			cancel()
+		}
+	}
+	summary, err := im.ImportCSV(ctx, strings.NewReader(IMPORT_CSV))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Interrupted import should return context.Canceled, got %v", err)
+	}
+	if summary.Imported != 2 || summary.Rejected != 1 {
+		t.Errorf("Interrupted import summary wrong: %+v", summary)
+	}
+	if !strings.Contains(rejects.String(), "not-an-email,midwest,pro,Nobody,") {
+		t.Errorf("Invalid email not written to rejects: %q", rejects.String())
+	}
+
+	summary, err = newImporter().ImportCSV(context.Background(), strings.NewReader(IMPORT_CSV))
+	if err != nil {
+		t.Fatalf("Resumed import error: %s", err)
+	}
+	if summary.Skipped != 3 || summary.Imported != 1 || summary.Rejected != 0 {
+		t.Errorf("Resumed import summary wrong: %+v", summary)
+	}
+	if len(srv.CallsTo("POST", "/user/one@example.com")) != 1 {
+		t.Errorf("Resumed import sent completed rows again")
+	}
+
+	u := srv.User("two@example.com")
+	attrs, _ := u["attributes"].(map[string]interface{})
+	if attrs["location"] != "eastwest" {
+		t.Fatalf("Import did not set attributes: %v", u)
+	}
+	if _, ok := attrs["plan"]; ok {
+		t.Errorf("Import sent empty cell as attribute: %v", u)
+	}
+	if props, _ := u["properties"].(map[string]interface{}); props["full_name"] != "Jane Two" {
+		t.Errorf("Import did not set properties: %v", u)
+	}
+}
+
+func TestUserImporterCSVMalformed(t *testing.T) {
+	srv := turretiotest.NewServer()
+	defer srv.Close()
+	srv.AddCredentials(VALID_API_KEY, VALID_API_SECRET)
+
+	input := `email,location
+one@example.com,midwest
+two@example.com,mid"west
+three@example.com,eastwest
+`
+	for _, omitHeader := range []bool{false, true} {
+		var rejects bytes.Buffer
+		im := turretIO.NewUserImporter(turretIO.NewUser(srv.Client(VALID_API_KEY, VALID_API_SECRET)))
+		im.Rejects = &rejects
+		im.OmitRejectsHeader = omitHeader
+		summary, err := im.ImportCSV(context.Background(), strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("Malformed row should not stop the import, got %v", err)
+		}
+		if summary.Imported != 2 || summary.Rejected != 1 {
+			t.Errorf("Malformed row import summary wrong: %+v", summary)
+		}
+		lines := strings.Split(strings.TrimSpace(rejects.String()), "\n")
+		expected := 2
+		if omitHeader {
+			expected = 1
+		}
+		if len(lines) != expected || !strings.Contains(lines[len(lines)-1], "line 3") {
+			t.Errorf("Malformed row not written to rejects with its line, omit header %v: %q", omitHeader, rejects.String())
+		}
+		if !omitHeader && lines[0] != "email,location,error" {
+			t.Errorf("Rejects should start with the CSV header, got %q", lines[0])
+		}
+	}
+	if srv.User("three@example.com") == nil {
+		t.Errorf("Rows after a malformed row should be imported")
+	}
+}
+
+func TestUserImporterJSONL(t *testing.T) {
+	srv := turretiotest.NewServer()
+	defer srv.Close()
+	srv.AddCredentials(VALID_API_KEY, VALID_API_SECRET)
+
+	input := `{"email": "one@example.com", "attributes": {"visits": 3}, "properties": {"full_name": "John One"}}
+
+   
+{"email": "one@example.com", "attributes":
+{"attributes": {"location": "midwest"}}
+`
+	var rejects bytes.Buffer
+	im := turretIO.NewUserImporter(turretIO.NewUser(srv.Client(VALID_API_KEY, VALID_API_SECRET)))
+	im.Rejects = &rejects
+	var rows []int
+	im.OnRow = func(row int, err error) {
+		rows = append(rows, row)
+	}
+	summary, err := im.ImportJSONL(context.Background(), strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ImportJSONL error: %s", err)
+	}
+	if summary.Imported != 1 || summary.Rejected != 2 {
+		t.Errorf("ImportJSONL summary wrong: %+v", summary)
+	}
+	if n := strings.Count(rejects.String(), "\n"); n != 2 {
+		t.Errorf("ImportJSONL wrote %d rejects, expected 2", n)
+	}
+	if fmt.Sprint(rows) != "[1 4 5]" {
+		t.Errorf("ImportJSONL should skip blank lines and number rows by line, got rows %v", rows)
+	}
+	u := srv.User("one@example.com")
+	if attrs, _ := u["attributes"].(map[string]interface{}); attrs["visits"] != "3" {
+		t.Errorf("ImportJSONL did not set attributes: %v", u)
+	}
+}
+
+// failingReader returns its content, then err instead of io.EOF
+type failingReader struct {
+	r   io.Reader
+	err error
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err == io.EOF {
+		return n, f.err
+	}
+	return n, err
+}
+
+func TestUserImporterCheckpointOnReadError(t *testing.T) {
+	srv := turretiotest.NewServer()
+	defer srv.Close()
+	srv.AddCredentials(VALID_API_KEY, VALID_API_SECRET)
+	readErr := errors.New("connection lost")
+	input := "{\"email\": \"one@example.com\"}\n{\"email\": \"two@example.com\"}\n"
+
+	// failing while skipping the rows of a previous run keeps the checkpoint
+	path := filepath.Join(t.TempDir(), "users.checkpoint")
+	if err := os.WriteFile(path, []byte("5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	im := turretIO.NewUserImporter(turretIO.NewUser(srv.Client(VALID_API_KEY, VALID_API_SECRET)))
+	im.CheckpointPath = path
+	_, err := im.ImportJSONL(context.Background(), &failingReader{strings.NewReader(input), readErr})
+	if !errors.Is(err, readErr) {
+		t.Fatalf("ImportJSONL should return the read error, got %v", err)
+	}
+	if data, _ := os.ReadFile(path); strings.TrimSpace(string(data)) != "5" {
+		t.Errorf("A read error while skipping rows should not lower the checkpoint, got %q", data)
+	}
+
+	// an error writing the checkpoint is reported with the read error
+	im.CheckpointPath = filepath.Join(t.TempDir(), "missing", "users.checkpoint")
+	summary, err := im.ImportJSONL(context.Background(), &failingReader{strings.NewReader(input), readErr})
+	if !errors.Is(err, readErr) || err == nil || !strings.Contains(err.Error(), "checkpoint") {
+		t.Errorf("ImportJSONL should report the checkpoint error with the read error, got %v", err)
+	}
+	if summary.Imported != 2 {
+		t.Errorf("ImportJSONL summary wrong: %+v", summary)
+	}
+}
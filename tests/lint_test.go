@@ -0,0 +1,105 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/turretIO/turret-io-go"
+	"github.com/turretIO/turret-io-go/turretiotest"
+)
+
+const LINT_CLEAN_HTML = `<html><body><p>Hello<br>
+<img src="https://example.com/logo.png" alt="Example Co">
+<img src="cid:banner@example.com" alt="Banner"> <img src="data:image/gif;base64,R0lGODlhAQABAAAAACw=" alt="">
+<a href="https://example.com/sale">Shop</a> <a href="mailto:help@example.com">Help</a>
+<p><a href="{{unsubscribe_url}}">Stop these emails</a></p>
+</body></html>`
+
+func TestLint(t *testing.T) {
+	clean := turretIO.EmailContent{Subject: "Spring sale", HTML: LINT_CLEAN_HTML}
+	if issues := turretIO.Lint(clean); len(issues) != 0 {
+		t.Errorf("Lint found issues in clean content: %v", issues)
+	}
+
+	dirty := turretIO.EmailContent{
+		Subject: strings.Repeat("Sale! ", 20),
+		HTML:    `<div><p>Hi <b>there</p><img src="https://example.com/x.png"><a href="/sale">Shop</a></span>`,
+	}
+	issues := turretIO.Lint(dirty)
+	rules := map[string]int{}
+	for _, i := range issues {
+		rules[i.Rule]++
+	}
+	expected := map[string]int{
+		turretIO.LINT_SUBJECT:        1,
+		turretIO.LINT_UNBALANCED_TAG: 3,
+		turretIO.LINT_IMAGE_ALT:      1,
+		turretIO.LINT_RELATIVE_LINK:  1,
+		turretIO.LINT_UNSUBSCRIBE:    1,
+	}
+	for rule, n := range expected {
+		if rules[rule] != n {
+			t.Errorf("Lint found %d %s issues, expected %d: %v", rules[rule], rule, n, issues)
+		}
+	}
+	if len(issues.Errors()) != 5 || issues[0].Severity != turretIO.LINT_ERROR {
+		t.Errorf("Lint errors wrong: %v", issues)
+	}
+
+	big := turretIO.EmailContent{Subject: "Big", HTML: LINT_CLEAN_HTML + strings.Repeat("x", turretIO.DEFAULT_LINT_MAX_HTML_BYTES)}
+	if issues := turretIO.Lint(big); len(issues) != 1 || issues[0].Rule != turretIO.LINT_SIZE {
+		t.Errorf("Lint did not report size: %v", issues)
+	}
+
+	mention := turretIO.EmailContent{Subject: "Hi", HTML: "<p>hi</p>", Plain: "We never let you unsubscribe"}
+	if issues := turretIO.Lint(mention); len(issues) != 1 || issues[0].Rule != turretIO.LINT_UNSUBSCRIBE {
+		t.Errorf("Lint should not take the word unsubscribe in the plain text for a link: %v", issues)
+	}
+
+	l := turretIO.NewLinter()
+	l.Severity = map[string]string{turretIO.LINT_UNSUBSCRIBE: ""}
+	if issues := l.Lint(turretIO.EmailContent{Subject: "Hi", HTML: "<p>Hi</p>"}); len(issues) != 0 {
+		t.Errorf("Disabled rule still reported: %v", issues)
+	}
+}
+
+func TestWithLint(t *testing.T) {
+	srv := turretiotest.NewServer()
+	defer srv.Close()
+	srv.AddCredentials(VALID_API_KEY, VALID_API_SECRET)
+	srv.SetTarget(TARGET_NAME, []map[string]interface{}{{"location": "midwest"}})
+
+	te := turretIO.NewTargetEmail(srv.Client(VALID_API_KEY, VALID_API_SECRET), turretIO.WithLint(turretIO.NewLinter()))
+	_, err := te.Create(TARGET_NAME, TARGET_EMAIL_SUBJ, TARGET_EMAIL_HTML_BODY, TARGET_EMAIL_PLAIN_BODY)
+	var lerr *turretIO.LintError
+	if !errors.As(err, &lerr) || !errors.Is(err, turretIO.ErrValidation) {
+		t.Fatalf("Create should return a LintError, got %v", err)
+	}
+	if len(srv.Calls()) != 0 {
+		t.Errorf("Create with lint errors called the API")
+	}
+
+	html := strings.Replace(LINT_CLEAN_HTML, `alt="Example Co"`, "", 1)
+	created, err := te.Create(TARGET_NAME, TARGET_EMAIL_SUBJ, html, TARGET_EMAIL_PLAIN_BODY)
+	if err != nil {
+		t.Fatalf("CreateTargetEmail error: %s", err)
+	}
+	if len(created.LintIssues) != 1 || created.LintIssues[0].Rule != turretIO.LINT_IMAGE_ALT {
+		t.Errorf("Create did not return lint warnings: %v", created.LintIssues)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/turretIO/turret-io-go"
+	"github.com/turretIO/turret-io-go/turretiotest"
+)
+
+func TestWithLogger(t *testing.T) {
+	srv := turretiotest.NewServer()
+	defer srv.Close()
+	srv.AddCredentials(VALID_API_KEY, VALID_API_SECRET)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	turret := srv.Client(VALID_API_KEY, VALID_API_SECRET, turretIO.WithLogger(logger))
+
+	method := turretIO.AWSSESMethod{AccessKey: "AKIDEXAMPLE", SecretKey: "wJalrXUtnFEMI"}
+	if _, err := turretIO.NewAccount(turret).Set(method); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, err := turretIO.NewTarget(turret).Get(TARGET_NAME); err == nil {
+		t.Fatalf("Get of a missing target should fail")
+	}
+
+	out := buf.String()
+	for _, secret := range []string{"AKIDEXAMPLE", "wJalrXUtnFEMI", VALID_API_KEY} {
+		if strings.Contains(out, secret) {
+			t.Errorf("Log should not contain %s:\n%s", secret, out)
+		}
+	}
+
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		var r map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("Invalid log line %s: %v", line, err)
+		}
+		records = append(records, r)
+	}
+	if len(records) != 4 {
+		t.Fatalf("Expected 2 attempts and 2 calls logged, got %d:\n%s", len(records), out)
+	}
+
+	attempt := records[0]
+	header, _ := attempt["header"].(map[string]interface{})
+	if attempt["level"] != "DEBUG" || header["X-Ls-Auth"].([]interface{})[0] != turretIO.REDACTED {
+		t.Errorf("Attempt should be logged with redacted headers, got %v", attempt)
+	}
+
+	options := attempt["payload"].(map[string]interface{})["options"].(map[string]interface{})
+	if options[turretIO.AWS_SECRET_ACCESS_KEY_NAME] != turretIO.REDACTED {
+		t.Errorf("Secret access key should be redacted, got %v", options)
+	}
+
+	set := records[1]
+	if set["level"] != "INFO" || set["method"] != "POST" || set["path"] != turretIO.ACCOUNT_RESOURCE_PATH+"/me" {
+		t.Errorf("Unexpected call record %v", set)
+	}
+	if set["resource"] != turretIO.RESOURCE_ACCOUNT || set["operation"] != turretIO.OPERATION_SET {
+		t.Errorf("Unexpected resource or operation %v", set)
+	}
+	if set["status"] != float64(200) || set["attempts"] != float64(1) || set["latency"] == nil {
+		t.Errorf("Expected status, attempts and latency, got %v", set)
+	}
+	if _, ok := set["payload"]; ok {
+		t.Errorf("Payloads, which hold personal data, should only be logged at debug level, got %v", set)
+	}
+
+	get := records[3]
+	if get["level"] != "ERROR" || get["status"] != float64(404) || get["error"] == nil {
+		t.Errorf("Failed call should be logged as an error with its status, got %v", get)
+	}
+}
+
+func TestRedactPayload(t *testing.T) {
+	payload := map[string]interface{}{
+		"type": turretIO.OUTGOING_METHOD_SMTP_NAME,
+		"options": map[string]interface{}{
+			turretIO.SMTP_HOST_NAME:     "smtp.example.com",
+			turretIO.SMTP_PASSWORD_NAME: "hunter2",
+		},
+		"properties": map[string]string{"api_secret": "s3cret", "name": "john"},
+	}
+	redacted := turretIO.RedactPayload(payload)
+	options := redacted["options"].(map[string]interface{})
+	if options[turretIO.SMTP_PASSWORD_NAME] != turretIO.REDACTED || options[turretIO.SMTP_HOST_NAME] != "smtp.example.com" {
+		t.Errorf("Unexpected options %v", options)
+	}
+	properties := redacted["properties"].(map[string]string)
+	if properties["api_secret"] != turretIO.REDACTED || properties["name"] != "john" {
+		t.Errorf("Unexpected properties %v", properties)
+	}
+	if payload["options"].(map[string]interface{})[turretIO.SMTP_PASSWORD_NAME] != "hunter2" {
+		t.Errorf("RedactPayload should not change its argument")
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/turretIO/turret-io-go"
+	"github.com/turretIO/turret-io-go/turretiotest"
+)
+
+func TestMiddleware(t *testing.T) {
+	srv := turretiotest.NewServer()
+	defer srv.Close()
+	srv.AddCredentials(VALID_API_KEY, VALID_API_SECRET)
+
+	var order []string
+	var seen []turretIO.Call
+	var statuses []int
+	outer := func(next turretIO.Handler) turretIO.Handler {
+		return func(ctx context.Context, call *turretIO.Call) (*turretIO.TurretIOResponse, error) {
+			order = append(order, "outer")
+			call.Header.Set("X-Request-Id", "42")
+			resp, err := next(ctx, call)
+			if err != nil {
+				return nil, err
+			}
+			seen = append(seen, *call)
+			statuses = append(statuses, resp.StatusCode)
+			return resp, nil
+		}
+	}
+	inner := func(next turretIO.Handler) turretIO.Handler {
+		return func(ctx context.Context, call *turretIO.Call) (*turretIO.TurretIOResponse, error) {
+			order = append(order, "inner")
+			return next(ctx, call)
+		}
+	}
+
+	turret := srv.Client(VALID_API_KEY, VALID_API_SECRET, turretIO.WithMiddleware(outer))
+	turret.Use(inner)
+	if _, err := turretIO.NewUser(turret).Set(EMAIL_TEST, map[string]string{"location": "midwest"}, nil); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, err := turretIO.NewTarget(turret).Get(TARGET_NAME); err == nil {
+		t.Fatalf("Get of a missing target should fail")
+	}
+
+	if want := []string{"outer", "inner", "outer", "inner"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("Middleware should run in the order added, got %v", order)
+	}
+	if len(seen) != 1 {
+		t.Fatalf("Expected 1 successful call, got %d", len(seen))
+	}
+	call := seen[0]
+	if call.Resource != turretIO.RESOURCE_USER || call.Operation != turretIO.OPERATION_SET || call.Method != "POST" {
+		t.Errorf("Unexpected call %s %s %s", call.Resource, call.Operation, call.Method)
+	}
+	if call.Path != turretIO.USER_RESOURCE_PATH+"/"+EMAIL_TEST {
+		t.Errorf("Unexpected path %s", call.Path)
+	}
+	if call.Payload["location"] != "midwest" {
+		t.Errorf("Middleware should see the payload, got %v", call.Payload)
+	}
+	if call.Attempts != 1 || statuses[0] != 200 {
+		t.Errorf("Expected 1 attempt answered with 200, got %d and %d", call.Attempts, statuses[0])
+	}
+
+	received := srv.CallsTo("POST", turretIO.USER_RESOURCE_PATH+"/"+EMAIL_TEST)
+	if len(received) != 1 || received[0].Header.Get("X-Request-Id") != "42" {
+		t.Errorf("Headers set by middleware should be sent, got %v", received)
+	}
+}
+
+func TestMiddlewareDirectRequest(t *testing.T) {
+	srv := turretiotest.NewServer()
+	defer srv.Close()
+	srv.AddCredentials(VALID_API_KEY, VALID_API_SECRET)
+
+	var call turretIO.Call
+	record := func(next turretIO.Handler) turretIO.Handler {
+		return func(ctx context.Context, c *turretIO.Call) (*turretIO.TurretIOResponse, error) {
+			call = *c
+			return next(ctx, c)
+		}
+	}
+	turret := srv.Client(VALID_API_KEY, VALID_API_SECRET, turretIO.WithMiddleware(record))
+	if _, err := turret.GetRequest(turretIO.ACCOUNT_RESOURCE_PATH, nil, turret.GetHTTPClient()); err != nil {
+		t.Fatalf("GetRequest failed: %v", err)
+	}
+	if call.Resource != turretIO.RESOURCE_ACCOUNT || call.Operation != "" || call.Method != "GET" {
+		t.Errorf("Unexpected call %s %q %s", call.Resource, call.Operation, call.Method)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/turretIO/turret-io-go"
+	"github.com/turretIO/turret-io-go/turretiotest"
+)
+
+// recordingTB collects the failures reported by assertion helpers
+type recordingTB struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Errorf(format string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func TestMock(t *testing.T) {
+	mock := turretiotest.NewMock()
+	mock.Respond("GET", "/user/*", 200, map[string]interface{}{
+		"email":      EMAIL_TEST,
+		"attributes": map[string]string{"location": "midwest"},
+	})
+	mock.Respond("POST", "/user/*", 200, map[string]interface{}{})
+	mock.Respond("GET", "/target/*", 404, map[string]interface{}{"error": "no such target"})
+	mock.Fail("POST", "/target/*/email/*/send", errors.New("connection reset"))
+
+	user := turretIO.NewUser(mock)
+	record, err := user.Get(EMAIL_TEST)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if record.Attributes["location"] != "midwest" {
+		t.Errorf("Unexpected record %+v", record)
+	}
+	if _, err := user.Set(EMAIL_TEST, map[string]string{"location": "west"}, map[string]string{"name": "john"}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	_, err = turretIO.NewTarget(mock).Get(TARGET_NAME)
+	var apiErr *turretIO.APIError
+	if !errors.Is(err, turretIO.ErrNotFound) || !errors.As(err, &apiErr) || apiErr.Message() != "no such target" {
+		t.Errorf("Expected a not found APIError, got %v", err)
+	}
+	if _, err := turretIO.NewTargetEmail(mock).Send(TARGET_NAME, "abc", "from@example.com"); err == nil || err.Error() != "connection reset" {
+		t.Errorf("Expected the programmed error, got %v", err)
+	}
+	if _, err := turretIO.NewAccount(mock).Get(); !errors.Is(err, turretiotest.ErrNoResponse) {
+		t.Errorf("Expected ErrNoResponse, got %v", err)
+	}
+
+	// the rule added last wins
+	mock.Respond("GET", "/user/"+EMAIL_TEST, 404, nil)
+	if _, err := user.Get(EMAIL_TEST); !errors.Is(err, turretIO.ErrNotFound) {
+		t.Errorf("Expected the overriding response, got %v", err)
+	}
+
+	mock.AssertCalled(t, "GET", "/user/"+EMAIL_TEST)
+	mock.AssertCallCount(t, "GET", "/user/*", 2)
+	mock.AssertCallCount(t, "", "/target/*", 1)
+	mock.AssertNotCalled(t, "POST", "/target/*")
+	mock.AssertPayload(t, "POST", "/user/*", map[string]interface{}{
+		"location":   "west",
+		"properties": map[string]string{"name": "john"},
+	})
+	if len(mock.Calls()) != 6 {
+		t.Errorf("Expected 6 calls, got %d", len(mock.Calls()))
+	}
+
+	rec := &recordingTB{TB: t}
+	mock.AssertCalled(rec, "POST", "/account/me")
+	mock.AssertNotCalled(rec, "GET", "/user/*")
+	mock.AssertCallCount(rec, "GET", "/user/*", 1)
+	mock.AssertPayload(rec, "POST", "/user/*", map[string]interface{}{"location": "east"})
+	if len(rec.failures) != 4 {
+		t.Errorf("Expected 4 failed assertions, got %q", rec.failures)
+	}
+
+	mock.Reset()
+	if len(mock.Calls()) != 0 {
+		t.Errorf("Reset should forget calls")
+	}
+	if _, err := user.Get(EMAIL_TEST); !errors.Is(err, turretiotest.ErrNoResponse) {
+		t.Errorf("Reset should forget responses, got %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"testing"
+
+	"github.com/turretIO/turret-io-go"
+	"github.com/turretIO/turret-io-go/turretiotest"
+)
+
+const PLAINTEXT_HTML = `<html><head><style>p { color: red; }</style></head><body>
+<h1>Spring   sale</h1>
+<!-- hero -->
+<p>Hi {{first_name}}, <b>everything</b> is 20% off &amp; shipping is free.<br>Ends soon.</p>
+<ul>
+  <li>Shoes</li>
+  <li>Hats<ol><li>Caps</li><li>Beanies</li></ol></li>
+</ul>
+<table><tr><th>Item</th><th>Price</th></tr><tr><td>Shoes</td><td>$40</td></tr></table>
+<p><a href="https://example.com/sale">Shop now</a> or write to <a href="mailto:help@example.com">help@example.com</a>.
+<img src="https://example.com/logo.png" alt="Example Co"></p>
+<script>track();</script>
+</body></html>`
+
+const PLAINTEXT_EXPECTED = `Spring sale
+===========
+
+Hi {{first_name}}, everything is 20% off & shipping is free.
+Ends soon.
+
+* Shoes
+* Hats
+  1. Caps
+  2. Beanies
+
+Item | Price
+Shoes | $40
+
+Shop now [1] or write to help@example.com. Example Co
+
+[1] https://example.com/sale`
+
+func TestHTMLToText(t *testing.T) {
+	if text := turretIO.HTMLToText(PLAINTEXT_HTML); text != PLAINTEXT_EXPECTED {
+		t.Errorf("HTMLToText returned\n%s\nexpected\n%s", text, PLAINTEXT_EXPECTED)
+	}
+	if text := turretIO.HTMLToText("1 < 2 and <3"); text != "1 < 2 and <3" {
+		t.Errorf("HTMLToText mangled text with \"<\": %q", text)
+	}
+}
+
+func TestDerivedPlain(t *testing.T) {
+	srv := turretiotest.NewServer()
+	defer srv.Close()
+	srv.AddCredentials(VALID_API_KEY, VALID_API_SECRET)
+	srv.SetTarget(TARGET_NAME, []map[string]interface{}{{"location": "midwest"}})
+
+	te := turretIO.NewTargetEmail(srv.Client(VALID_API_KEY, VALID_API_SECRET), turretIO.WithDerivedPlain())
+	created, err := te.Create(TARGET_NAME, TARGET_EMAIL_SUBJ, PLAINTEXT_HTML, "")
+	if err != nil {
+		t.Fatalf("CreateTargetEmail error: %s", err)
+	}
+	if created.DerivedPlain != PLAINTEXT_EXPECTED || created.Plain != PLAINTEXT_EXPECTED {
+		t.Errorf("Create did not send the derived plain body: %+v", created)
+	}
+
+	updated, err := te.Update(TARGET_NAME, created.ID, TARGET_EMAIL_SUBJ, PLAINTEXT_HTML, TARGET_EMAIL_PLAIN_BODY)
+	if err != nil {
+		t.Fatalf("UpdateTargetEmail error: %s", err)
+	}
+	if updated.DerivedPlain != "" || updated.Plain != TARGET_EMAIL_PLAIN_BODY {
+		t.Errorf("Update replaced a given plain body: %+v", updated)
+	}
+}
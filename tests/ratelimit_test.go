@@ -0,0 +1,140 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/turretIO/turret-io-go"
+	"github.com/turretIO/turret-io-go/turretiotest"
+)
+
+func TestRateLimiter(t *testing.T) {
+	srv := turretiotest.NewServer()
+	defer srv.Close()
+	srv.AddCredentials(VALID_API_KEY, VALID_API_SECRET)
+
+	limiter := newRateLimiter(t, 50, 1)
+	turret := srv.Client(VALID_API_KEY, VALID_API_SECRET, turretIO.WithResourceRateLimiter(turretIO.RESOURCE_USER, limiter))
+	user := turretIO.NewUser(turret)
+
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		user.Set(EMAIL_TEST, map[string]string{"location": "midwest"}, nil)
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("6 calls at 50/s with a burst of 1 should take at least 100ms, took %s", elapsed)
+	}
+
+	ctx := turretIO.WithRateLimitFailFast(context.Background())
+	if _, err := user.GetContext(ctx, EMAIL_TEST); !errors.Is(err, turretIO.ErrRateLimited) {
+		t.Errorf("Fail fast context should return ErrRateLimited, got %v", err)
+	}
+
+	// other resources are not throttled by the user limiter
+	if _, err := turretIO.NewAccount(turret).GetContext(ctx); err != nil {
+		t.Errorf("Account call should not be throttled by the user limiter, got %v", err)
+	}
+}
+
+func TestRateLimiterReleasesTokens(t *testing.T) {
+	srv := turretiotest.NewServer()
+	defer srv.Close()
+	srv.AddCredentials(VALID_API_KEY, VALID_API_SECRET)
+
+	global := newRateLimiter(t, 0.1, 1)
+	user := newRateLimiter(t, 0.1, 1)
+	if !user.Allow() {
+		t.Fatalf("New limiter should allow a call")
+	}
+	turret := srv.Client(VALID_API_KEY, VALID_API_SECRET,
+		turretIO.WithRateLimiter(global), turretIO.WithResourceRateLimiter(turretIO.RESOURCE_USER, user))
+
+	ctx := turretIO.WithRateLimitFailFast(context.Background())
+	if _, err := turretIO.NewUser(turret).GetContext(ctx, EMAIL_TEST); !errors.Is(err, turretIO.ErrRateLimited) {
+		t.Fatalf("Exhausted user limiter should return ErrRateLimited, got %v", err)
+	}
+	// the call was not made, so the global token is still available
+	if _, err := turretIO.NewAccount(turret).GetContext(ctx); err != nil {
+		t.Errorf("Failed call should give back the global token, got %v", err)
+	}
+}
+
+func TestNewRateLimiterInvalidRate(t *testing.T) {
+	for _, rate := range []float64{0, -1, math.NaN(), math.Inf(1)} {
+		if _, err := turretIO.NewRateLimiter(rate, 1); !errors.Is(err, turretIO.ErrValidation) {
+			t.Errorf("NewRateLimiter(%v, 1) should return ErrValidation, got %v", rate, err)
+		}
+	}
+}
+
+func TestRateLimiterPause(t *testing.T) {
+	limiter := newRateLimiter(t, 50, 10)
+	start := time.Now()
+	limiter.PauseUntil(start.Add(50 * time.Millisecond))
+
+	woken := make(chan time.Duration, 3)
+	for i := 0; i < cap(woken); i++ {
+		go func() {
+			limiter.Wait(context.Background())
+			woken <- time.Since(start)
+		}()
+	}
+	var times []time.Duration
+	for i := 0; i < cap(woken); i++ {
+		times = append(times, <-woken)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	if times[0] < 45*time.Millisecond {
+		t.Errorf("Waiters should sleep through the pause, first woke after %s", times[0])
+	}
+	// 50 calls per second after the pause, not a burst of the 10 saved tokens
+	if spread := times[2] - times[0]; spread < 35*time.Millisecond {
+		t.Errorf("Waiters should resume one at a time, all woke within %s: %v", spread, times)
+	}
+}
+
+func newRateLimiter(t *testing.T, rate float64, burst int) *turretIO.RateLimiter {
+	limiter, err := turretIO.NewRateLimiter(rate, burst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return limiter
+}
+
+func TestRateLimiterPausesOn429(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	limiter := newRateLimiter(t, 1000, 10)
+	turret := turretIO.NewTurretIOWithOptions(API_KEY, API_SECRET,
+		turretIO.WithBaseURL(server.URL), turretIO.WithRateLimiter(limiter))
+	if _, err := turretIO.NewTarget(turret).Get(TARGET_NAME); !errors.Is(err, turretIO.ErrRateLimited) {
+		t.Errorf("429 should return ErrRateLimited, got %v", err)
+	}
+	if limiter.Allow() {
+		t.Errorf("Limiter should pause after a 429 with Retry-After")
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"testing"
+
+	"github.com/turretIO/turret-io-go"
+	"github.com/turretIO/turret-io-go/turretiotest"
+)
+
+func TestMatchingTargets(t *testing.T) {
+	srv := turretiotest.NewServer()
+	defer srv.Close()
+	srv.AddCredentials(VALID_API_KEY, VALID_API_SECRET)
+	// shorthand rules, as stored by targets created before rule groups existed
+	srv.SetTarget("midwest", []map[string]interface{}{{"location": "midwest"}})
+	fetched, err := turretIO.NewTarget(srv.Client(VALID_API_KEY, VALID_API_SECRET)).Get("midwest")
+	if err != nil {
+		t.Fatalf("GetTarget error: %s", err)
+	}
+
+	engaged, err := turretIO.NewTargetRecord("engaged",
+		turretIO.Or(turretIO.GreaterThan("logins", 10), turretIO.Equals("premium", true)),
+		turretIO.NotEquals("plan", "free"),
+	)
+	if err != nil {
+		t.Fatalf("NewTargetRecord error: %s", err)
+	}
+	gmail, err := turretIO.NewTargetRecord("gmail", turretIO.Contains("domain", "gmail"))
+	if err != nil {
+		t.Fatalf("NewTargetRecord error: %s", err)
+	}
+	targets := []*turretIO.TargetRecord{fetched, engaged, gmail}
+
+	cases := []struct {
+		attributes map[string]string
+		expected   []string
+	}{
+		{map[string]string{"location": "midwest", "logins": "12", "domain": "gmail.com"}, []string{"midwest", "engaged", "gmail"}},
+		{map[string]string{"location": "midwest", "logins": "12", "plan": "free"}, []string{"midwest"}},
+		{map[string]string{"logins": "3", "premium": "true"}, []string{"engaged"}},
+		{map[string]string{"logins": "ten"}, nil},
+		{nil, nil},
+	}
+	for _, c := range cases {
+		matching, err := turretIO.MatchingTargets(targets, c.attributes)
+		if err != nil {
+			t.Fatalf("MatchingTargets error: %s", err)
+		}
+		var names []string
+		for _, m := range matching {
+			names = append(names, m.Name)
+		}
+		if len(names) != len(c.expected) {
+			t.Errorf("MatchingTargets(%v) = %v, expected %v", c.attributes, names, c.expected)
+			continue
+		}
+		for i := range names {
+			if names[i] != c.expected[i] {
+				t.Errorf("MatchingTargets(%v) = %v, expected %v", c.attributes, names, c.expected)
+				break
+			}
+		}
+	}
+}
+
+func TestAttributeRuleEquals(t *testing.T) {
+	cases := []struct {
+		rule     turretIO.TargetRule
+		actual   string
+		expected bool
+	}{
+		{turretIO.Equals("logins", "10"), "10.0", true},
+		{turretIO.Equals("logins", "10.0"), "10", true},
+		{turretIO.Equals("logins", 10), "10.0", true},
+		{turretIO.Equals("logins", 10.5), "10.50", true},
+		{turretIO.Equals("logins", "10"), "11", false},
+		{turretIO.Equals("logins", 10), "ten", false},
+		{turretIO.Equals("location", "midwest"), "midwest", true},
+		{turretIO.Equals("location", "midwest"), "Midwest", false},
+		{turretIO.Equals("premium", true), "true", true},
+		{turretIO.Equals("score", "NaN"), "NaN", true},
+		{turretIO.NotEquals("logins", "10"), "10.0", false},
+		{turretIO.NotEquals("logins", "10"), "12", true},
+	}
+	for _, c := range cases {
+		target, err := turretIO.NewTargetRecord("t", c.rule)
+		if err != nil {
+			t.Fatalf("NewTargetRecord error: %s", err)
+		}
+		rule := target.Attributes[0]
+		ok, err := rule.Matches(map[string]string{rule.Name: c.actual})
+		if err != nil {
+			t.Fatalf("Matches error: %s", err)
+		}
+		if ok != c.expected {
+			t.Errorf("%s %s %#v against %q = %v, expected %v", rule.Name, rule.Op, rule.Value, c.actual, ok, c.expected)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/turretIO/turret-io-go"
+	"github.com/turretIO/turret-io-go/turretiotest"
+)
+
+func TestAttributeList(t *testing.T) {
+	invalid := []turretIO.TargetRule{
+		turretIO.Equals("", "midwest"),
+		turretIO.GreaterThan("logins", "many"),
+		turretIO.Contains("location", ""),
+		turretIO.Condition{Attribute: "location", Op: "like", Value: "mid%"},
+		turretIO.Or(),
+		turretIO.And(turretIO.Equals("location", "midwest"), turretIO.Equals("plan", []string{"pro"})),
+	}
+	for _, r := range invalid {
+		if _, err := turretIO.AttributeList(r); !errors.Is(err, turretIO.ErrValidation) {
+			t.Errorf("AttributeList(%+v) should return ErrValidation, got %v", r, err)
+		}
+	}
+
+	list, err := turretIO.AttributeList(
+		turretIO.Equals("location", "midwest"),
+		turretIO.Or(turretIO.GreaterThan("logins", 10), turretIO.NotEquals("plan", "free")),
+	)
+	if err != nil {
+		t.Fatalf("AttributeList error: %s", err)
+	}
+	if list[0]["location"] != "midwest" {
+		t.Errorf("Equality should use the shorthand form: %v", list[0])
+	}
+
+	srv := turretiotest.NewServer()
+	defer srv.Close()
+	srv.AddCredentials(VALID_API_KEY, VALID_API_SECRET)
+	target, err := turretIO.NewTarget(srv.Client(VALID_API_KEY, VALID_API_SECRET)).Create(TARGET_NAME, list)
+	if err != nil {
+		t.Fatalf("CreateTarget error: %s", err)
+	}
+	if len(target.Attributes) != 2 {
+		t.Fatalf("Target attributes not decoded: %+v", target.Attributes)
+	}
+	group := target.Attributes[1]
+	if group.Op != turretIO.GROUP_OR || len(group.Rules) != 2 {
+		t.Fatalf("Rule group not decoded: %+v", group)
+	}
+	if gt := group.Rules[0]; gt.Name != "logins" || gt.Op != turretIO.CONDITION_GREATER_THAN || gt.Value != float64(10) {
+		t.Errorf("Condition not decoded: %+v", gt)
+	}
+}
+
+func TestAttributeRuleRoundTrip(t *testing.T) {
+	for _, name := range []string{"name", "op", "rules", "value"} {
+		list, err := turretIO.AttributeList(turretIO.Equals(name, "Bob"), turretIO.NotEquals(name, "Alice"))
+		if err != nil {
+			t.Fatalf("AttributeList error: %s", err)
+		}
+		data, err := json.Marshal(list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rules []turretIO.AttributeRule
+		if err := json.Unmarshal(data, &rules); err != nil {
+			t.Fatalf("Decoding %s: %s", data, err)
+		}
+		if len(rules) != 2 || rules[0].Name != name || rules[0].Value != "Bob" || rules[0].Op != "" {
+			t.Errorf("Equality on %s not decoded from %s: %+v", name, data, rules)
+		}
+		if len(rules) == 2 && (rules[1].Name != name || rules[1].Op != turretIO.CONDITION_NOT_EQUALS || rules[1].Value != "Alice") {
+			t.Errorf("Condition on %s not decoded from %s: %+v", name, data, rules[1])
+		}
+
+		target, err := turretIO.NewTargetRecord(TARGET_NAME, turretIO.Equals(name, "Bob"))
+		if err != nil {
+			t.Fatalf("NewTargetRecord error: %s", err)
+		}
+		if ok, err := target.Matches(map[string]string{name: "Bob"}); !ok || err != nil {
+			t.Errorf("Target on %s = Bob should match, got %v, %v", name, ok, err)
+		}
+	}
+}
+
+func TestAttributeRuleSeveralKeys(t *testing.T) {
+	srv := turretiotest.NewServer()
+	defer srv.Close()
+	srv.AddCredentials(VALID_API_KEY, VALID_API_SECRET)
+	srv.SetTarget(TARGET_NAME, []map[string]interface{}{{"location": "midwest", "logins": "10"}})
+
+	target, err := turretIO.NewTarget(srv.Client(VALID_API_KEY, VALID_API_SECRET)).Get(TARGET_NAME)
+	if err != nil {
+		t.Fatalf("Target with a several key attribute object should decode, got %v", err)
+	}
+	if len(target.Attributes) != 1 || target.Attributes[0].Op != turretIO.GROUP_AND || len(target.Attributes[0].Rules) != 2 {
+		t.Fatalf("Several key object should be a group of equality rules, got %+v", target.Attributes)
+	}
+	if ok, _ := target.Matches(map[string]string{"location": "midwest", "logins": "10"}); !ok {
+		t.Errorf("Target should match a user with both attributes")
+	}
+	if ok, _ := target.Matches(map[string]string{"location": "midwest"}); ok {
+		t.Errorf("Target should not match a user with one of the attributes")
+	}
+
+	var rule turretIO.AttributeRule
+	if err := json.Unmarshal([]byte(`{"name": "logins", "op": 5, "value": 10}`), &rule); err == nil {
+		t.Errorf("Invalid op should fail to decode, got %+v", rule)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/turretIO/turret-io-go"
+	"github.com/turretIO/turret-io-go/turretiotest"
+)
+
+const TARGET_DEFINITIONS = `{"targets": [
+	{"name": "midwest", "attributes": [{"location": "midwest"}]},
+	{"name": "engaged", "attributes": [
+		{"op": "or", "rules": [{"name": "logins", "op": "gt", "value": 10}, {"premium": "1"}]},
+		{"name": "plan", "op": "ne", "value": "free"}
+	]},
+	{"name": "new", "attributes": [{"name": "domain", "op": "contains", "value": "gmail"}]}
+]}`
+
+func TestLoadTargetDefinitions(t *testing.T) {
+	invalid := []string{
+		`{"targets": [{"name": "a", "attributes": [{"name": "logins", "op": "gt", "value": "many"}]}]}`,
+		`{"targets": [{"name": "a", "attributes": []}]}`,
+		`{"targets": [{"name": "a", "attributes": [{"x": "1"}]}, {"name": "a", "attributes": [{"x": "1"}]}]}`,
+		`{"target": []}`,
+	}
+	for _, s := range invalid {
+		if _, err := turretIO.LoadTargetDefinitions(strings.NewReader(s)); !errors.Is(err, turretIO.ErrValidation) {
+			t.Errorf("LoadTargetDefinitions(%s) should return ErrValidation, got %v", s, err)
+		}
+	}
+}
+
+func TestTargetSync(t *testing.T) {
+	srv := turretiotest.NewServer()
+	defer srv.Close()
+	srv.AddCredentials(VALID_API_KEY, VALID_API_SECRET)
+	srv.SetTarget("midwest", []map[string]interface{}{{"location": "midwest"}})
+	srv.SetTarget("engaged", []map[string]interface{}{
+		{"name": "plan", "op": "ne", "value": "free"},
+		{"name": "logins", "op": "gt", "value": 5},
+	})
+
+	defs, err := turretIO.LoadTargetDefinitions(strings.NewReader(TARGET_DEFINITIONS))
+	if err != nil {
+		t.Fatalf("LoadTargetDefinitions error: %s", err)
+	}
+	sync := turretIO.NewTargetSync(turretIO.NewTarget(srv.Client(VALID_API_KEY, VALID_API_SECRET)))
+	plan, err := sync.Plan(defs)
+	if err != nil {
+		t.Fatalf("Plan error: %s", err)
+	}
+	expected := `~ engaged (destructive)
+    - logins > 5
+    + (logins > 10 OR premium = "1")
++ new
+    + domain contains "gmail"
+1 to create, 1 to update, 1 unchanged
+`
+	if plan.String() != expected {
+		t.Errorf("Plan is\n%s\nexpected\n%s", plan, expected)
+	}
+
+	if _, err := sync.Apply(plan, false); !errors.Is(err, turretIO.ErrDestructiveChange) {
+		t.Fatalf("Apply should refuse destructive changes, got %v", err)
+	}
+	if len(srv.CallsTo("POST", "/target/new")) != 0 {
+		t.Errorf("Refused Apply still created targets")
+	}
+
+	applied, err := sync.Apply(plan, true)
+	if err != nil {
+		t.Fatalf("Apply error: %s", err)
+	}
+	if len(applied) != 2 {
+		t.Errorf("Apply returned %d targets, expected 2", len(applied))
+	}
+	plan, err = sync.Plan(defs)
+	if err != nil || plan.Count(turretIO.TARGET_UNCHANGED) != 3 {
+		t.Errorf("Plan after Apply not empty (%v):\n%s", err, plan)
+	}
+}
+
+func TestTargetSyncNumericValues(t *testing.T) {
+	srv := turretiotest.NewServer()
+	defer srv.Close()
+	srv.AddCredentials(VALID_API_KEY, VALID_API_SECRET)
+	// the API returns numbers as strings and the other way around
+	srv.SetTarget("midwest", []map[string]interface{}{{"location": "midwest"}})
+	srv.SetTarget("engaged", []map[string]interface{}{
+		{"name": "plan", "op": "ne", "value": "free"},
+		{"op": "or", "rules": []map[string]interface{}{{"name": "logins", "op": "gt", "value": "10"}, {"premium": 1}}},
+	})
+	srv.SetTarget("new", []map[string]interface{}{{"name": "domain", "op": "contains", "value": "gmail"}})
+
+	defs, err := turretIO.LoadTargetDefinitions(strings.NewReader(TARGET_DEFINITIONS))
+	if err != nil {
+		t.Fatalf("LoadTargetDefinitions error: %s", err)
+	}
+	plan, err := turretIO.NewTargetSync(turretIO.NewTarget(srv.Client(VALID_API_KEY, VALID_API_SECRET))).Plan(defs)
+	if err != nil {
+		t.Fatalf("Plan error: %s", err)
+	}
+	if plan.Count(turretIO.TARGET_UNCHANGED) != 3 {
+		t.Errorf("Numbers and strings holding them should compare equal:\n%s", plan)
+	}
+}
+
+func TestTargetSyncReorderedGroups(t *testing.T) {
+	srv := turretiotest.NewServer()
+	defer srv.Close()
+	srv.AddCredentials(VALID_API_KEY, VALID_API_SECRET)
+	srv.SetTarget("midwest", []map[string]interface{}{{"location": "midwest"}})
+	srv.SetTarget("engaged", []map[string]interface{}{
+		{"op": "or", "rules": []map[string]interface{}{{"premium": "1"}, {"name": "logins", "op": "gt", "value": 10}}},
+		{"name": "plan", "op": "ne", "value": "free"},
+	})
+	srv.SetTarget("new", []map[string]interface{}{{"name": "domain", "op": "contains", "value": "gmail"}})
+
+	defs, err := turretIO.LoadTargetDefinitions(strings.NewReader(TARGET_DEFINITIONS))
+	if err != nil {
+		t.Fatalf("LoadTargetDefinitions error: %s", err)
+	}
+	plan, err := turretIO.NewTargetSync(turretIO.NewTarget(srv.Client(VALID_API_KEY, VALID_API_SECRET))).Plan(defs)
+	if err != nil {
+		t.Fatalf("Plan error: %s", err)
+	}
+	if plan.Count(turretIO.TARGET_UNCHANGED) != 3 {
+		t.Errorf("Groups listing the same rules in another order should compare equal:\n%s", plan)
+	}
+}
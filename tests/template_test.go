@@ -0,0 +1,86 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/turretIO/turret-io-go"
+	"github.com/turretIO/turret-io-go/turretiotest"
+)
+
+func TestRenderer(t *testing.T) {
+	content := turretIO.EmailContent{
+		Subject: "Hi {{ first_name }}",
+		HTML:    "<p>Hi {{first_name}}, your plan is {{plan}}. Sent to {{email}}. {{ bad name }} {{coupon</p>",
+		Plain:   "Hi {{first_name}}, use {{ cuopon_code }}",
+	}
+	r := turretIO.NewRenderer("first_name", "plan", "coupon_code")
+	result := r.Render(content, "john@example.com", map[string]string{"first_name": "<John>"})
+
+	if result.Subject != "Hi <John>" {
+		t.Errorf("Subject rendered wrong: %q", result.Subject)
+	}
+	expected := "<p>Hi &lt;John&gt;, your plan is . Sent to john@example.com. {{ bad name }} {{coupon</p>"
+	if result.HTML != expected {
+		t.Errorf("HTML rendered wrong:\n%q\nexpected\n%q", result.HTML, expected)
+	}
+
+	kinds := map[string]string{}
+	for _, p := range result.Problems {
+		kinds[p.Text] = p.Kind
+	}
+	expectedKinds := map[string]string{
+		"{{plan}}":          turretIO.PLACEHOLDER_MISSING,
+		"{{ bad name }}":    turretIO.PLACEHOLDER_MALFORMED,
+		"{{coupon</p>":      turretIO.PLACEHOLDER_MALFORMED,
+		"{{ cuopon_code }}": turretIO.PLACEHOLDER_UNKNOWN,
+	}
+	if len(result.Problems) != len(expectedKinds) {
+		t.Errorf("Render found %d problems, expected %d: %v", len(result.Problems), len(expectedKinds), result.Problems)
+	}
+	for text, kind := range expectedKinds {
+		if kinds[text] != kind {
+			t.Errorf("Placeholder %s reported %q, expected %q", text, kinds[text], kind)
+		}
+	}
+	if !errors.Is(result.Err(), turretIO.ErrValidation) {
+		t.Errorf("RenderResult.Err should match ErrValidation, got %v", result.Err())
+	}
+	if names := r.Placeholders(content); len(names) != 4 {
+		t.Errorf("Placeholders returned %v", names)
+	}
+}
+
+func TestPlaceholderCheck(t *testing.T) {
+	srv := turretiotest.NewServer()
+	defer srv.Close()
+	srv.AddCredentials(VALID_API_KEY, VALID_API_SECRET)
+	srv.SetTarget(TARGET_NAME, []map[string]interface{}{{"location": "midwest"}})
+
+	te := turretIO.NewTargetEmail(srv.Client(VALID_API_KEY, VALID_API_SECRET), turretIO.WithPlaceholderCheck(turretIO.NewRenderer("first_name")))
+	_, err := te.Create(TARGET_NAME, "Hi {{firstname}}", TARGET_EMAIL_HTML_BODY, TARGET_EMAIL_PLAIN_BODY)
+	var terr *turretIO.TemplateError
+	if !errors.As(err, &terr) || len(terr.Problems) != 1 {
+		t.Fatalf("Create should return a TemplateError, got %v", err)
+	}
+	if len(srv.Calls()) != 0 {
+		t.Errorf("Create with bad placeholders called the API")
+	}
+	if _, err := te.Create(TARGET_NAME, "Hi {{first_name}}", TARGET_EMAIL_HTML_BODY, TARGET_EMAIL_PLAIN_BODY); err != nil {
+		t.Errorf("CreateTargetEmail error: %s", err)
+	}
+}
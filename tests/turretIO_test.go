@@ -15,8 +15,16 @@
 package turretIO
 
 import (
+	"context"
+	"errors"
+	"io"
 	"testing"
+	"time"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"github.com/turretIO/turret-io-go"
+	"github.com/turretIO/turret-io-go/turretiotest"
 	_ "fmt"
 )
 
@@ -36,6 +44,21 @@ const OUTGOING_METHOD_SMTP="smtp"
 const AWS_ACCESS_KEY_NAME="aws_access_key"
 const AWS_SECRET_ACCESS_KEY_NAME="aws_secret_access_key"
 
+var fakeServer *turretiotest.Server
+
+func TestMain(m *testing.M) {
+	fakeServer = turretiotest.NewServer()
+	code := m.Run()
+	fakeServer.Close()
+	os.Exit(code)
+}
+
+// newTurret returns a TurretIO talking to the fake server, which does not
+// know about API_KEY and answers 401 Unauthorized
+func newTurret() *turretIO.TurretIO {
+	return fakeServer.Client(API_KEY, API_SECRET)
+}
+
 func TestNewInstance(t *testing.T) {
 	inst := turretIO.NewTurretIO(API_KEY, API_SECRET)
 	if inst.Apikey != API_KEY || inst.Apisecret != API_SECRET {
@@ -43,9 +66,273 @@ func TestNewInstance(t *testing.T) {
 	}
 }
 
+func TestNewInstanceWithOptions(t *testing.T) {
+	client := &http.Client{}
+	inst := turretIO.NewTurretIOWithOptions(API_KEY, API_SECRET,
+		turretIO.WithBaseURL("http://localhost:8080/"),
+		turretIO.WithAPIVersion("v2"),
+		turretIO.WithHTTPClient(client))
+
+	if inst.GetBaseURL() != "http://localhost:8080" {
+		t.Errorf("WithBaseURL not setting base URL, got %s", inst.GetBaseURL())
+	}
+	if inst.GetAPIVersion() != "v2" {
+		t.Errorf("WithAPIVersion not setting API version, got %s", inst.GetAPIVersion())
+	}
+	if inst.GetHTTPClient() != client {
+		t.Errorf("WithHTTPClient not setting HTTP client")
+	}
+
+	inst = turretIO.NewTurretIO(API_KEY, API_SECRET)
+	if inst.GetBaseURL() != turretIO.ENDPOINT || inst.GetAPIVersion() != turretIO.DEFAULT_API_VERSION {
+		t.Errorf("NewTurretIO not defaulting base URL and API version")
+	}
+}
+
+func TestRequestHonorsBaseURL(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte(`{"email":"test@example.com"}`))
+	}))
+	defer server.Close()
+
+	turret := turretIO.NewTurretIOWithOptions(API_KEY, API_SECRET,
+		turretIO.WithBaseURL(server.URL), turretIO.WithAPIVersion("v2"))
+	inst := turretIO.NewUser(turret)
+	if _, err := inst.Get(EMAIL_TEST); err != nil {
+		t.Errorf("GetUser error: %s", err)
+	}
+	if path != "/v2/user/"+EMAIL_TEST {
+		t.Errorf("Request sent to %s instead of configured base URL and version", path)
+	}
+}
+
+func TestRequestDeprecatedPaths(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte(`{"email":"test@example.com"}`))
+	}))
+	defer server.Close()
+
+	turret := turretIO.NewTurretIOWithOptions(API_KEY, API_SECRET, turretIO.WithBaseURL(server.URL))
+	if turretIO.USER_PATH != "/latest/user" {
+		t.Errorf("USER_PATH changed to %s", turretIO.USER_PATH)
+	}
+	if _, err := turret.GetRequest(turretIO.USER_PATH+"/"+EMAIL_TEST, nil, turret.GetHTTPClient()); err != nil {
+		t.Errorf("GetRequest error: %s", err)
+	}
+	if path != "/latest/user/"+EMAIL_TEST {
+		t.Errorf("Request with USER_PATH sent to %s", path)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"user not found"}`))
+	}))
+	defer server.Close()
+
+	turret := turretIO.NewTurretIOWithOptions(API_KEY, API_SECRET, turretIO.WithBaseURL(server.URL))
+	inst := turretIO.NewUser(turret)
+	_, err := inst.Get(EMAIL_TEST)
+	if !errors.Is(err, turretIO.ErrNotFound) {
+		t.Errorf("GetUser should return ErrNotFound on 404, got %v", err)
+	}
+
+	var apiErr *turretIO.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("GetUser should return an *APIError, got %T", err)
+	}
+	if apiErr.StatusCode != http.StatusNotFound || apiErr.Method != "GET" || apiErr.Path != "/user/"+EMAIL_TEST {
+		t.Errorf("APIError not carrying status, method and path: %+v", apiErr)
+	}
+	if apiErr.Message() != "user not found" {
+		t.Errorf("APIError not parsing error body, got %s", apiErr.Message())
+	}
+	if errors.Is(err, turretIO.ErrUnauthorized) {
+		t.Errorf("404 APIError should not match ErrUnauthorized")
+	}
+}
+
+func TestContextCancellation(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	turret := turretIO.NewTurretIOWithOptions(API_KEY, API_SECRET, turretIO.WithBaseURL(server.URL))
+	inst := turretIO.NewTarget(turret)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := inst.GetContext(ctx, TARGET_NAME)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetContext should stop at the context deadline, got %v", err)
+	}
+}
+
+func fastRetryPolicy() *turretIO.RetryPolicy {
+	policy := turretIO.DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+	policy.MaxBackoff = 5 * time.Millisecond
+	return policy
+}
+
+func TestRetryPolicy(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if r.Header.Get("X-Ls-Time") == "" || r.Header.Get("X-Ls-Auth") == "" {
+			t.Errorf("Retried request not signed")
+		}
+		if attempts < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	turret := turretIO.NewTurretIOWithOptions(API_KEY, API_SECRET,
+		turretIO.WithBaseURL(server.URL), turretIO.WithRetryPolicy(fastRetryPolicy()))
+	inst := turretIO.NewUser(turret)
+	if _, err := inst.Set(EMAIL_TEST, map[string]string{"location": "midwest"}, nil); err != nil {
+		t.Errorf("SetUser should succeed after retries, got %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+
+	// Send is not idempotent and must not be retried unless opted in
+	attempts = 0
+	email := turretIO.NewTargetEmail(turret)
+	_, err := email.Send(TARGET_NAME, EMAIL_ID, TARGET_EMAIL_FROM)
+	if err == nil || attempts != 1 {
+		t.Errorf("Send should not be retried by default, got %d attempts", attempts)
+	}
+
+	policy := fastRetryPolicy()
+	policy.RetryNonIdempotent = true
+	turret = turretIO.NewTurretIOWithOptions(API_KEY, API_SECRET,
+		turretIO.WithBaseURL(server.URL), turretIO.WithRetryPolicy(policy))
+	attempts = 0
+	email = turretIO.NewTargetEmail(turret)
+	if _, err := email.Send(TARGET_NAME, EMAIL_ID, TARGET_EMAIL_FROM); err != nil || attempts != 3 {
+		t.Errorf("Send should be retried when RetryNonIdempotent is set, got %d attempts, %v", attempts, err)
+	}
+}
+
+func TestRetryPolicyTransportErrors(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			// drop the connection without answering
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.Write([]byte(`{"email":"test@example.com"}`))
+	}))
+	defer server.Close()
+
+	turret := turretIO.NewTurretIOWithOptions(API_KEY, API_SECRET,
+		turretIO.WithBaseURL(server.URL), turretIO.WithRetryPolicy(fastRetryPolicy()))
+	if _, err := turretIO.NewUser(turret).Get(EMAIL_TEST); err != nil || attempts != 3 {
+		t.Errorf("Dropped connections should be retried, got %d attempts, %v", attempts, err)
+	}
+}
+
+func TestRetryPolicyNotRetried(t *testing.T) {
+	attempts := 0
+	var handler http.HandlerFunc
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		handler(w, r)
+	}))
+	defer server.Close()
+
+	policy := fastRetryPolicy()
+	policy.RetryNonIdempotent = true
+	turret := turretIO.NewTurretIOWithOptions(API_KEY, API_SECRET,
+		turretIO.WithBaseURL(server.URL), turretIO.WithRetryPolicy(policy))
+	email := turretIO.NewTargetEmail(turret)
+
+	// the email was sent, whatever the body says
+	handler = func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("sent"))
+	}
+	if _, err := email.Send(TARGET_NAME, EMAIL_ID, TARGET_EMAIL_FROM); err == nil || attempts != 1 {
+		t.Errorf("2xx with an invalid body should fail without retries, got %d attempts, %v", attempts, err)
+	}
+
+	attempts = 0
+	handler = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte(`{"status":`))
+	}
+	if _, err := email.Send(TARGET_NAME, EMAIL_ID, TARGET_EMAIL_FROM); !errors.Is(err, io.ErrUnexpectedEOF) || attempts != 1 {
+		t.Errorf("2xx with a truncated body should fail without retries, got %d attempts, %v", attempts, err)
+	}
+
+	attempts = 0
+	policy.InitialBackoff, policy.MaxBackoff = 100*time.Millisecond, time.Second
+	turret = turretIO.NewTurretIOWithOptions(API_KEY, "not base64!",
+		turretIO.WithBaseURL(server.URL), turretIO.WithRetryPolicy(policy))
+	start := time.Now()
+	if _, err := turretIO.NewUser(turret).Get(EMAIL_TEST); err == nil || attempts != 0 || time.Since(start) > 50*time.Millisecond {
+		t.Errorf("Signing errors should fail at once, got %d attempts in %s, %v", attempts, time.Since(start), err)
+	}
+}
+
+func TestTypedRecords(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest/user/" + EMAIL_TEST:
+			w.Write([]byte(`{"email":"test@example.com","attributes":{"location":"midwest","logins":10},"properties":{"full_name":"john smith"},"signup":"2014-01-01"}`))
+		case "/latest/target/" + TARGET_NAME:
+			w.Write([]byte(`{"name":"eastwest","attributes":[{"location":"midwest"},{"name":"logins","op":"gt","value":"5"}]}`))
+		case "/latest/account":
+			w.Write([]byte(`{"email":"owner@example.com","outgoing_method":{"type":"smtp","options":{"smtp_host":"mail.example.com"}}}`))
+		}
+	}))
+	defer server.Close()
+
+	turret := turretIO.NewTurretIOWithOptions(API_KEY, API_SECRET, turretIO.WithBaseURL(server.URL))
+	user, err := turretIO.NewUser(turret).Get(EMAIL_TEST)
+	if err != nil {
+		t.Fatalf("GetUser error: %s", err)
+	}
+	if user.Email != EMAIL_TEST || user.Attributes["location"] != "midwest" || user.Attributes["logins"] != "10" || user.Properties["full_name"] != "john smith" {
+		t.Errorf("UserRecord not decoded: %+v", user)
+	}
+	if user.Raw["signup"] != "2014-01-01" {
+		t.Errorf("UserRecord not keeping unknown fields in Raw")
+	}
+
+	target, err := turretIO.NewTarget(turret).Get(TARGET_NAME)
+	if err != nil {
+		t.Fatalf("GetTarget error: %s", err)
+	}
+	if len(target.Attributes) != 2 || target.Attributes[0].Name != "location" || target.Attributes[0].Value != "midwest" || target.Attributes[1].Op != "gt" {
+		t.Errorf("TargetRecord not decoded: %+v", target)
+	}
+
+	account, err := turretIO.NewAccount(turret).Get()
+	if err != nil {
+		t.Fatalf("GetAccount error: %s", err)
+	}
+	if account.OutgoingMethod.Type != turretIO.OUTGOING_METHOD_SMTP_NAME || account.OutgoingMethod.Options["smtp_host"] != "mail.example.com" {
+		t.Errorf("AccountRecord not decoded: %+v", account)
+	}
+}
 
 func TestNewUserInstance(t *testing.T) {
-	turret := turretIO.NewTurretIO(API_KEY, API_SECRET)
+	turret := newTurret()
 	inst := turretIO.NewUser(turret)
 	if inst.TH.GetApikey() != API_KEY || inst.TH.GetApisecret() != API_SECRET {
 		t.Errorf("NewUserInstance not setting API key or secret")
@@ -53,39 +340,33 @@ func TestNewUserInstance(t *testing.T) {
 }
 
 func TestGetUser(t *testing.T) {
-	turret := turretIO.NewTurretIO(API_KEY, API_SECRET)
+	turret := newTurret()
 	inst := turretIO.NewUser(turret)
-	resp, err := inst.Get(EMAIL_TEST)
-	if err != nil {
-		t.Errorf("GetUser error")
-	}
+	_, err := inst.Get(EMAIL_TEST)
 	// We should see a 401 here because we're using a bad API KEY / SECRET
-	if resp.Status != "401 Unauthorized" {
+	if !errors.Is(err, turretIO.ErrUnauthorized) {
 		t.Errorf("%s Should throw 401 Unauthorized, unless you changed the API key and secret", "TestGetUser")
 	}
 }
 
 func TestSetUser(t *testing.T) {
-	turret := turretIO.NewTurretIO(API_KEY, API_SECRET)
+	turret := newTurret()
 	inst := turretIO.NewUser(turret)
 	attr_map := make(map[string]string)
 	prop_map := make(map[string]string)
 
 	attr_map["location"] = "midwest"
 	prop_map["full_name"] = "john smith"
-	resp, err := inst.Set(EMAIL_TEST, attr_map, prop_map)
-	if err != nil {
-		t.Errorf("SetUser error")
-	}
+	_, err := inst.Set(EMAIL_TEST, attr_map, prop_map)
 
 	// We should see a 401 here because we're using a bad API KEY / SECRET
-	if resp.Status != "401 Unauthorized" {
+	if !errors.Is(err, turretIO.ErrUnauthorized) {
 		t.Errorf("%s Should throw 401 Unauthorized, unless you changed the API key and secret", "TestSetUser")
 	}
 }
 
 func TestNewTargetEmailInstance(t *testing.T) {
-	turret := turretIO.NewTurretIO(API_KEY, API_SECRET)
+	turret := newTurret()
 	inst := turretIO.NewTargetEmail(turret)
 	if inst.TH.GetApikey() != API_KEY || inst.TH.GetApisecret() != API_SECRET {
 		t.Errorf("NewTargetEmailInstance not setting API key or secret")
@@ -93,77 +374,62 @@ func TestNewTargetEmailInstance(t *testing.T) {
 }
 
 func TestGetTargetEmail(t *testing.T) {
-	turret := turretIO.NewTurretIO(API_KEY, API_SECRET)
+	turret := newTurret()
 	inst := turretIO.NewTargetEmail(turret)
-	resp, err := inst.Get(TARGET_NAME, EMAIL_ID)
-	if err != nil {
-		t.Errorf("GetTargetEmail error")
-	}
+	_, err := inst.Get(TARGET_NAME, EMAIL_ID)
 
 	// We should see a 401 here because we're using a bad API KEY / SECRET
-	if resp.Status != "401 Unauthorized" {
+	if !errors.Is(err, turretIO.ErrUnauthorized) {
 		t.Errorf("%s Should throw 401 Unauthorized, unless you changed the API key and secret", "TestGetTargetEmail")
 	}
 }
 
 func TestCreateTargetEmail(t *testing.T) {
-	turret := turretIO.NewTurretIO(API_KEY, API_SECRET)
+	turret := newTurret()
 	inst := turretIO.NewTargetEmail(turret)
-	resp, err := inst.Create(TARGET_NAME, TARGET_EMAIL_SUBJ, TARGET_EMAIL_HTML_BODY, TARGET_EMAIL_PLAIN_BODY)
-	if err != nil {
-		t.Errorf("CreateTargetEmail error")
-	}
+	_, err := inst.Create(TARGET_NAME, TARGET_EMAIL_SUBJ, TARGET_EMAIL_HTML_BODY, TARGET_EMAIL_PLAIN_BODY)
 
 	// We should see a 401 here because we're using a bad API KEY / SECRET
-	if resp.Status != "401 Unauthorized" {
+	if !errors.Is(err, turretIO.ErrUnauthorized) {
 		t.Errorf("%s Should throw 401 Unauthorized, unless you changed the API key and secret", "TestCreateTargetEmail")
 	}
 }
 
 func TestUpdateTargetEmail(t *testing.T) {
-	turret := turretIO.NewTurretIO(API_KEY, API_SECRET)
+	turret := newTurret()
 	inst := turretIO.NewTargetEmail(turret)
-	resp, err := inst.Update(TARGET_NAME, EMAIL_ID, TARGET_EMAIL_SUBJ, TARGET_EMAIL_HTML_BODY, TARGET_EMAIL_PLAIN_BODY)
-	if err != nil {
-		t.Errorf("UpdateTargetEmail error")
-	}
+	_, err := inst.Update(TARGET_NAME, EMAIL_ID, TARGET_EMAIL_SUBJ, TARGET_EMAIL_HTML_BODY, TARGET_EMAIL_PLAIN_BODY)
 
 	// We should see a 401 here because we're using a bad API KEY / SECRET
-	if resp.Status != "401 Unauthorized" {
+	if !errors.Is(err, turretIO.ErrUnauthorized) {
 		t.Errorf("%s Should throw 401 Unauthorized, unless you changed the API key and secret", "TestUpdateTargetEmail")
 	}
 }
 
 func TestSendTestTargetEmail(t *testing.T) {
-	turret := turretIO.NewTurretIO(API_KEY, API_SECRET)
+	turret := newTurret()
 	inst := turretIO.NewTargetEmail(turret)
-	resp, err := inst.SendTest(TARGET_NAME, EMAIL_ID, TARGET_EMAIL_FROM, TARGET_EMAIL_RECIPIENT)
-	if err != nil {
-		t.Errorf("SendTestTargetEmail error")
-	}
+	_, err := inst.SendTest(TARGET_NAME, EMAIL_ID, TARGET_EMAIL_FROM, TARGET_EMAIL_RECIPIENT)
 
 	// We should see a 401 here because we're using a bad API KEY / SECRET
-	if resp.Status != "401 Unauthorized" {
+	if !errors.Is(err, turretIO.ErrUnauthorized) {
 		t.Errorf("%s Should throw 401 Unauthorized, unless you changed the API key and secret", "TestSendTestTargetEmail")
 	}
 }
 
 func TestSendTargetEmail(t *testing.T) {
-	turret := turretIO.NewTurretIO(API_KEY, API_SECRET)
+	turret := newTurret()
 	inst := turretIO.NewTargetEmail(turret)
-	resp, err := inst.Send(TARGET_NAME, EMAIL_ID, TARGET_EMAIL_FROM)
-	if err != nil {
-		t.Errorf("SendTargetEmail error")
-	}
+	_, err := inst.Send(TARGET_NAME, EMAIL_ID, TARGET_EMAIL_FROM)
 
 	// We should see a 401 here because we're using a bad API KEY / SECRET
-	if resp.Status != "401 Unauthorized" {
+	if !errors.Is(err, turretIO.ErrUnauthorized) {
 		t.Errorf("%s Should throw 401 Unauthorized, unless you changed the API key and secret", "TestSendTargetEmail")
 	}
 }
 
 func TestNewTargetInstance(t *testing.T) {
-	turret := turretIO.NewTurretIO(API_KEY, API_SECRET)
+	turret := newTurret()
 	inst := turretIO.NewTarget(turret)
 	if inst.TH.GetApikey() != API_KEY || inst.TH.GetApisecret() != API_SECRET {
 		t.Errorf("NewTarget not setting API key or secret")
@@ -171,55 +437,44 @@ func TestNewTargetInstance(t *testing.T) {
 }
 
 func TestGetTarget(t *testing.T) {
-	turret := turretIO.NewTurretIO(API_KEY, API_SECRET)
+	turret := newTurret()
 	inst := turretIO.NewTarget(turret)
-	resp, err := inst.Get(TARGET_NAME)
-	if err != nil {
-		t.Errorf("GetTarget error")
-	}
+	_, err := inst.Get(TARGET_NAME)
 
 	// We should see a 401 here because we're using a bad API KEY / SECRET
-	if resp.Status != "401 Unauthorized" {
+	if !errors.Is(err, turretIO.ErrUnauthorized) {
 		t.Errorf("%s Should throw 401 Unauthorized, unless you changed the API key and secret", "TestGetTarget")
 	}
 }
 
 func TestCreateTarget(t *testing.T) {
-	turret := turretIO.NewTurretIO(API_KEY, API_SECRET)
+	turret := newTurret()
 	inst := turretIO.NewTarget(turret)
 	attr_map := make(map[string]interface {})
 	attr_map["location"] = "midwest"
-	resp, err := inst.Create(TARGET_NAME, attr_map)
-
-	if err != nil {
-		t.Errorf("CreateTarget error")
-	}
+	_, err := inst.Create(TARGET_NAME, []map[string]interface{}{attr_map})
 
 	// We should see a 401 here because we're using a bad API KEY / SECRET
-	if resp.Status != "401 Unauthorized" {
+	if !errors.Is(err, turretIO.ErrUnauthorized) {
 		t.Errorf("%s Should throw 401 Unauthorized, unless you changed the API key and secret", "TestGetTarget")
 	}
 }
 
 func TestUpdateTarget(t *testing.T) {
-	turret := turretIO.NewTurretIO(API_KEY, API_SECRET)
+	turret := newTurret()
 	inst := turretIO.NewTarget(turret)
 	attr_map := make(map[string]interface {})
 	attr_map["location"] = "midwest"
-	resp, err := inst.Update(TARGET_NAME, attr_map)
-
-	if err != nil {
-		t.Errorf("UpdateTarget error")
-	}
+	_, err := inst.Update(TARGET_NAME, []map[string]interface{}{attr_map})
 
 	// We should see a 401 here because we're using a bad API KEY / SECRET
-	if resp.Status != "401 Unauthorized" {
+	if !errors.Is(err, turretIO.ErrUnauthorized) {
 		t.Errorf("%s Should throw 401 Unauthorized, unless you changed the API key and secret", "TestUpdateTarget")
 	}
 }
 
 func TestNewAccountInstance(t *testing.T) {
-	turret := turretIO.NewTurretIO(API_KEY, API_SECRET)
+	turret := newTurret()
 	inst := turretIO.NewAccount(turret)
 	if inst.TH.GetApikey() != API_KEY || inst.TH.GetApisecret() != API_SECRET {
 		t.Errorf("NewTarget not setting API key or secret")
@@ -227,63 +482,85 @@ func TestNewAccountInstance(t *testing.T) {
 }
 
 func TestGetAccount(t *testing.T) {
-	turret := turretIO.NewTurretIO(API_KEY, API_SECRET)
+	turret := newTurret()
 	inst := turretIO.NewAccount(turret)
-	resp, err := inst.Get()
-	if err != nil {
-		t.Errorf("GetAccount error")
-	}
+	_, err := inst.Get()
 
 	// We should see a 401 here because we're using a bad API KEY / SECRET
-	if resp.Status != "401 Unauthorized" {
+	if !errors.Is(err, turretIO.ErrUnauthorized) {
 		t.Errorf("%s Should throw 401 Unauthorized, unless you changed the API key and secret", "TestGetAccount")
 	}
 }
 
 func TestSetAccount(t *testing.T) {
-	turret := turretIO.NewTurretIO(API_KEY, API_SECRET)
+	turret := newTurret()
 	inst := turretIO.NewAccount(turret)
-	resp, err := inst.Set(OUTGOING_METHOD_TURRET, nil)
-	if err != nil {
-		t.Errorf("SetAccount error")
+	_, err := inst.Set(turretIO.TurretIOMethod{})
+	// We should see a 401 here because we're using a bad API KEY / SECRET
+	if !errors.Is(err, turretIO.ErrUnauthorized) {
+		t.Errorf("%s Should throw 401 Unauthorized, unless you changed the API key and secret", "TestSetAccount")
+	}
+
+	_, err = inst.Set(nil)
+	if !errors.Is(err, turretIO.ErrValidation) { // This is an error *IF NO ERROR* if produced
+		t.Errorf("Set should return ErrValidation if no method is provided")
+	}
+
+	_, err = inst.Set(turretIO.AWSSESMethod{AccessKey: "abc123"})
+	if !errors.Is(err, turretIO.ErrValidation) { // This is an error *IF NO ERROR* if produced
+		t.Errorf("Set should return error if AWS is used and only %s OR %s are present", AWS_ACCESS_KEY_NAME, AWS_SECRET_ACCESS_KEY_NAME)
 	}
+
+	_, err = inst.Set(turretIO.SMTPMethod{Host: "mail.example.com", Username: "user"})
+	if !errors.Is(err, turretIO.ErrValidation) { // This is an error *IF NO ERROR* if produced
+		t.Errorf("Set should return error if SMTP is used without a password")
+	}
+
+	_, err = inst.Set(turretIO.AWSSESMethod{AccessKey: "abc123", SecretKey: "defghi"})
 	// We should see a 401 here because we're using a bad API KEY / SECRET
-	if resp.Status != "401 Unauthorized" {
+	if !errors.Is(err, turretIO.ErrUnauthorized) {
 		t.Errorf("%s Should throw 401 Unauthorized, unless you changed the API key and secret", "TestSetAccount")
 	}
+}
 
-	resp, err = inst.Set("invalid_method", nil)
+func TestParseOutgoingMethod(t *testing.T) {
+	_, err := turretIO.ParseOutgoingMethod("invalid_method", nil)
 	if err == nil { // This is an error *IF NO ERROR* if produced
-		t.Errorf("Set should return error if an invalid method is provided")
+		t.Errorf("ParseOutgoingMethod should return error if an invalid method is provided")
 	}
 
-	resp, err = inst.Set(OUTGOING_METHOD_AWS, nil)
+	_, err = turretIO.ParseOutgoingMethod("x"+OUTGOING_METHOD_SMTP+"x", nil)
 	if err == nil { // This is an error *IF NO ERROR* if produced
-		t.Errorf("Set should return error if AWS is used and no options present")
+		t.Errorf("ParseOutgoingMethod should not accept method names containing a valid one")
 	}
 
-	options := make(map[string]interface {})
-	options[AWS_ACCESS_KEY_NAME] = "abc123"
-	resp, err = inst.Set(OUTGOING_METHOD_AWS, options)
+	_, err = turretIO.ParseOutgoingMethod(OUTGOING_METHOD_AWS, nil)
 	if err == nil { // This is an error *IF NO ERROR* if produced
-		t.Errorf("Set should return error if AWS is used and only %s OR %s are present", AWS_ACCESS_KEY_NAME, AWS_SECRET_ACCESS_KEY_NAME)
+		t.Errorf("ParseOutgoingMethod should return error if AWS is used and no options present")
 	}
 
-	options = make(map[string]interface {})
+	options := make(map[string]interface{})
 	options[AWS_SECRET_ACCESS_KEY_NAME] = "defghi"
-	resp, err = inst.Set(OUTGOING_METHOD_AWS, options)
+	_, err = turretIO.ParseOutgoingMethod(OUTGOING_METHOD_AWS, options)
 	if err == nil { // This is an error *IF NO ERROR* if produced
-		t.Errorf("Set should return error if AWS is used and only %s OR %s are present", AWS_ACCESS_KEY_NAME, AWS_SECRET_ACCESS_KEY_NAME)
+		t.Errorf("ParseOutgoingMethod should return error if AWS is used and only %s OR %s are present", AWS_ACCESS_KEY_NAME, AWS_SECRET_ACCESS_KEY_NAME)
 	}
 
-	options = make(map[string]interface {})
 	options[AWS_ACCESS_KEY_NAME] = "abc123"
-	options[AWS_SECRET_ACCESS_KEY_NAME] = "defghi"
+	m, err := turretIO.ParseOutgoingMethod(OUTGOING_METHOD_AWS, options)
+	if err != nil {
+		t.Fatalf("ParseOutgoingMethod error: %s", err)
+	}
+	if m != (turretIO.AWSSESMethod{AccessKey: "abc123", SecretKey: "defghi"}) {
+		t.Errorf("ParseOutgoingMethod not mapping AWS options, got %+v", m)
+	}
 
-	resp, err = inst.Set(OUTGOING_METHOD_AWS, options)
-	// We should see a 401 here because we're using a bad API KEY / SECRET
-	if resp.Status != "401 Unauthorized" {
-		t.Errorf("%s Should throw 401 Unauthorized, unless you changed the API key and secret", "TestSetAccount")
+	smtp := turretIO.SMTPMethod{Host: "mail.example.com", Port: 587, Username: "user", Password: "secret", TLSMode: turretIO.SMTP_TLS_MODE_STARTTLS}
+	if smtp.Options()[turretIO.SMTP_PORT_NAME] != 587 || smtp.Options()[turretIO.SMTP_TLS_MODE_NAME] != "starttls" {
+		t.Errorf("SMTPMethod not serializing port and TLS mode: %v", smtp.Options())
+	}
+	smtp.TLSMode = "ssl3"
+	if smtp.Validate() == nil {
+		t.Errorf("SMTPMethod should reject unknown TLS modes")
 	}
 }
-
@@ -0,0 +1,85 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/turretIO/turret-io-go"
+	"github.com/turretIO/turret-io-go/turretiotest"
+)
+
+const VALID_API_KEY = "dmFsaWQ="
+const VALID_API_SECRET = "c2VjcmV0"
+
+func TestFakeServerRoundTrip(t *testing.T) {
+	srv := turretiotest.NewServer()
+	defer srv.Close()
+	srv.AddCredentials(VALID_API_KEY, VALID_API_SECRET)
+	turret := srv.Client(VALID_API_KEY, VALID_API_SECRET)
+
+	user := turretIO.NewUser(turret)
+	if _, err := user.Get(EMAIL_TEST); !errors.Is(err, turretIO.ErrNotFound) {
+		t.Errorf("Unknown user should return ErrNotFound, got %v", err)
+	}
+	if _, err := user.Set(EMAIL_TEST, map[string]string{"location": "midwest"}, map[string]string{"full_name": "john smith"}); err != nil {
+		t.Fatalf("SetUser error: %s", err)
+	}
+	u, err := user.Get(EMAIL_TEST)
+	if err != nil {
+		t.Fatalf("GetUser error: %s", err)
+	}
+	if u.Attributes["location"] != "midwest" || u.Properties["full_name"] != "john smith" {
+		t.Errorf("Fake server not storing user: %+v", u)
+	}
+
+	target := turretIO.NewTarget(turret)
+	if _, err := target.Create(TARGET_NAME, []map[string]interface{}{{"location": "midwest"}}); err != nil {
+		t.Fatalf("CreateTarget error: %s", err)
+	}
+
+	email := turretIO.NewTargetEmail(turret)
+	created, err := email.Create(TARGET_NAME, TARGET_EMAIL_SUBJ, TARGET_EMAIL_HTML_BODY, TARGET_EMAIL_PLAIN_BODY)
+	if err != nil {
+		t.Fatalf("CreateTargetEmail error: %s", err)
+	}
+	if created.ID == "" || created.Subject != TARGET_EMAIL_SUBJ {
+		t.Errorf("Fake server not creating target email: %+v", created)
+	}
+	if _, err := email.Send(TARGET_NAME, created.ID, TARGET_EMAIL_FROM); err != nil {
+		t.Errorf("SendTargetEmail error: %s", err)
+	}
+
+	sends := srv.CallsTo("POST", "/target/"+TARGET_NAME+"/email/"+created.ID+"/send")
+	if len(sends) != 1 || sends[0].Payload["email_from"] != TARGET_EMAIL_FROM {
+		t.Errorf("Fake server not recording send call: %+v", sends)
+	}
+	if len(srv.Calls()) != 6 {
+		t.Errorf("Fake server should have recorded 6 calls, got %d", len(srv.Calls()))
+	}
+}
+
+func TestFakeServerRejectsBadSignature(t *testing.T) {
+	srv := turretiotest.NewServer()
+	defer srv.Close()
+	srv.AddCredentials(VALID_API_KEY, VALID_API_SECRET)
+
+	// right key, wrong secret
+	turret := srv.Client(VALID_API_KEY, API_SECRET)
+	if _, err := turretIO.NewAccount(turret).Get(); !errors.Is(err, turretIO.ErrUnauthorized) {
+		t.Errorf("Fake server should reject bad signatures, got %v", err)
+	}
+}
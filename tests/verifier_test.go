@@ -0,0 +1,138 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/turretIO/turret-io-go"
+)
+
+// captureSignedRequest sends a User.Set through the client and returns the raw request body and headers
+func captureSignedRequest(t *testing.T) (string, []byte, http.Header) {
+	var path string
+	var body []byte
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header.Clone()
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	turret := turretIO.NewTurretIOWithOptions(VALID_API_KEY, VALID_API_SECRET, turretIO.WithBaseURL(server.URL))
+	if _, err := turretIO.NewUser(turret).Set(EMAIL_TEST, map[string]string{"location": "midwest"}, nil); err != nil {
+		t.Fatalf("SetUser error: %s", err)
+	}
+	return path, body, header
+}
+
+func newSignedRequest(path string, body []byte, header http.Header) *http.Request {
+	r := httptest.NewRequest("POST", path, bytes.NewReader(body))
+	r.Header = header.Clone()
+	return r
+}
+
+func lookupValidSecret(api_key string) (string, error) {
+	if api_key != VALID_API_KEY {
+		return "", errors.New("unknown key")
+	}
+	return VALID_API_SECRET, nil
+}
+
+func TestVerifier(t *testing.T) {
+	path, body, header := captureSignedRequest(t)
+	v := turretIO.NewVerifier(lookupValidSecret)
+
+	r := newSignedRequest(path, body, header)
+	signed, err := v.Verify(r)
+	if err != nil {
+		t.Fatalf("Verify should accept a request signed by the client, got %v", err)
+	}
+	if signed.APIKey != VALID_API_KEY || string(signed.Payload) != `{"location":"midwest"}` {
+		t.Errorf("Verify not returning key and payload: %+v", signed)
+	}
+	if restored, _ := io.ReadAll(r.Body); !bytes.Equal(restored, body) {
+		t.Errorf("Verify should restore the request body")
+	}
+
+	if _, err := v.Verify(newSignedRequest(path, body, header)); !errors.Is(err, turretIO.ErrReplayedRequest) {
+		t.Errorf("Verify should reject replayed requests, got %v", err)
+	}
+
+	tampered := newSignedRequest(path+"x", body, header)
+	if _, err := turretIO.NewVerifier(lookupValidSecret).Verify(tampered); !errors.Is(err, turretIO.ErrInvalidSignature) {
+		t.Errorf("Verify should reject requests with a modified path, got %v", err)
+	}
+
+	late := turretIO.NewVerifier(lookupValidSecret)
+	late.Now = func() time.Time { return time.Now().Add(time.Hour) }
+	if _, err := late.Verify(newSignedRequest(path, body, header)); !errors.Is(err, turretIO.ErrStaleRequest) {
+		t.Errorf("Verify should reject requests outside the skew window, got %v", err)
+	}
+}
+
+func TestVerifierAcceptsRetries(t *testing.T) {
+	v := turretIO.NewVerifier(lookupValidSecret)
+	attempts := 0
+	server := httptest.NewServer(v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{}`))
+	})))
+	defer server.Close()
+
+	policy := turretIO.DefaultRetryPolicy()
+	policy.InitialBackoff = 50 * time.Millisecond
+	policy.Jitter = 0
+	turret := turretIO.NewTurretIOWithOptions(VALID_API_KEY, VALID_API_SECRET,
+		turretIO.WithBaseURL(server.URL), turretIO.WithRetryPolicy(policy))
+	if _, err := turretIO.NewUser(turret).Set(EMAIL_TEST, map[string]string{"location": "midwest"}, nil); err != nil {
+		t.Fatalf("A retry within the same second should not be taken for a replay, got %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", attempts)
+	}
+}
+
+func TestVerifierMaxBodyBytes(t *testing.T) {
+	path, body, header := captureSignedRequest(t)
+	v := turretIO.NewVerifier(lookupValidSecret)
+	v.MaxBodyBytes = int64(len(body) - 1)
+	if _, err := v.Verify(newSignedRequest(path, body, header)); !errors.Is(err, turretIO.ErrBodyTooLarge) {
+		t.Errorf("Verify should reject bodies over MaxBodyBytes, got %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	v.Middleware(http.NotFoundHandler()).ServeHTTP(rec, newSignedRequest(path, body, header))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Middleware should answer 413 to bodies over MaxBodyBytes, got %d", rec.Code)
+	}
+
+	v.MaxBodyBytes = int64(len(body))
+	if _, err := v.Verify(newSignedRequest(path, body, header)); err != nil {
+		t.Errorf("Verify should accept bodies up to MaxBodyBytes, got %v", err)
+	}
+}
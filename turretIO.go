@@ -15,10 +15,10 @@
 package turretIO
 
 import (
+	"context"
     "fmt"
+    "strings"
     _ "log"
-	"regexp"
-	"errors"
 	_ "runtime/debug"
 )
 
@@ -31,8 +31,11 @@ func NewUser(inter TurretInterface) *User {
 
 // NewTargetEmail creates a new TargetEmail instance.
 // Must be provided a TurretInterface (TurretIO or AppEngineTurretIO)
-func NewTargetEmail(inter TurretInterface) *TargetEmail {
-	te := &TargetEmail{inter}
+func NewTargetEmail(inter TurretInterface, opts ...TargetEmailOption) *TargetEmail {
+	te := &TargetEmail{TH: inter}
+	for _, opt := range opts {
+		opt(te)
+	}
 	return te
 }
 
@@ -55,79 +58,52 @@ type Account struct {
 	TH TurretInterface
 }
 
-// Get loads the account based on the owner of the authenticated API call
-func (a *Account) Get() (*TurretIOResponse, error) {
-	payload := make(map[string]interface{})
-	url := fmt.Sprintf("%s", ACCOUNT_PATH)
-	resp, err := a.TH.GetRequest(url, &payload, a.TH.GetHTTPClient())
-	return resp, err
-}
-
-// Set updates the owner of the authenticated API call's account.
-// Possible outgoing methods: turret.io, aws, smtp
-// Options:
-// turret.io: None
-// aws: aws_access_key (required)
-//      aws_secret_access_key (required)
-// smtp: smtp_host (required)
-// 		 smtp_username (required)
-// 		 smtp_password (required)
-
-func (a *Account) Set(outgoing_method string, options map[string]interface {}) (*TurretIOResponse, error) {
+// GetContext loads the account based on the owner of the authenticated API call
+func (a *Account) GetContext(ctx context.Context) (*AccountRecord, error) {
+	ctx = withOperation(ctx, OPERATION_GET)
 	payload := make(map[string]interface{})
-	// validate outgoing_method
-	if ok, _ := regexp.MatchString(OUTGOING_METHOD_OPTIONS_REGEXP, outgoing_method); !ok {
-		return nil, errors.New("Invalid outgoing method")
+	url := fmt.Sprintf("%s", ACCOUNT_RESOURCE_PATH)
+	resp, err := a.TH.GetRequestContext(ctx, url, &payload, a.TH.GetHTTPClient())
+	if err != nil {
+		return nil, err
 	}
+	return newAccountRecord(resp)
+}
 
-	if outgoing_method == OUTGOING_METHOD_TURRET_IO_NAME && options != nil {
-		return nil, errors.New("Turret.IO is outgoing method with non-nil options")
-	}
+// Get works like GetContext using context.Background()
+func (a *Account) Get() (*AccountRecord, error) {
+	return a.GetContext(context.Background())
+}
 
-	if outgoing_method != OUTGOING_METHOD_TURRET_IO_NAME && options == nil {
-		return nil, errors.New("Non Turret.IO outgoing methods require options")
+// SetContext updates the owner of the authenticated API call's account to send
+// email with the provided outgoing method: TurretIOMethod, AWSSESMethod or SMTPMethod.
+// The method is validated before any request is made.
+func (a *Account) SetContext(ctx context.Context, method OutgoingMethod) (*AccountRecord, error) {
+	ctx = withOperation(ctx, OPERATION_SET)
+	if method == nil {
+		return nil, fmt.Errorf("%w: outgoing method is required", ErrValidation)
 	}
-
-
-	if outgoing_method == OUTGOING_METHOD_TURRET_IO_NAME {
-		payload["type"] = OUTGOING_METHOD_TURRET_IO_NAME
+	if err := method.Validate(); err != nil {
+		return nil, err
 	}
 
-	if outgoing_method == OUTGOING_METHOD_AWS_NAME {
-		// require aws_acces_key and aws_secret_access_key
-		if _, ok := options[AWS_ACCESS_KEY_NAME]; !ok {
-			return nil, errors.New("outgoing method AWS requires aws access key")
-		}
-
-		if _, ok := options[AWS_SECRET_ACCESS_KEY_NAME]; !ok {
-			return nil, errors.New("outgoing method AWS requires aws secret access key")
-		}
-		payload["type"] = OUTGOING_METHOD_AWS_NAME
+	payload := make(map[string]interface{})
+	payload["type"] = method.Type()
+	if options := method.Options(); options != nil {
 		payload["options"] = options
-
 	}
 
-	if outgoing_method == OUTGOING_METHOD_SMTP_NAME {
-		// require aws_acces_key and aws_secret_access_key
-		if _, ok := options[SMTP_HOST_NAME]; !ok {
-			return nil, errors.New("outgoing method smtp requires options host name, username, password")
-		}
-
-		if _, ok := options[SMTP_USERNAME_NAME]; !ok {
-			return nil, errors.New("outgoing method smtp requires options host name, username, password")
-		}
-
-		if _, ok := options[SMTP_PASSWORD_NAME]; !ok {
-			return nil, errors.New("outgoing method smtp requires options host name, username, password")
-		}
-
-		payload["type"] = OUTGOING_METHOD_SMTP_NAME
-		payload["options"] = options
+	url := fmt.Sprintf("%s/me", ACCOUNT_RESOURCE_PATH)
+	resp, err := a.TH.PostRequestContext(ctx, url, &payload, a.TH.GetHTTPClient())
+	if err != nil {
+		return nil, err
 	}
+	return newAccountRecord(resp)
+}
 
-	url := fmt.Sprintf("%s/me", ACCOUNT_PATH)
-	resp, err := a.TH.PostRequest(url, &payload, a.TH.GetHTTPClient())
-	return resp, err
+// Set works like SetContext using context.Background()
+func (a *Account) Set(method OutgoingMethod) (*AccountRecord, error) {
+	return a.SetContext(context.Background(), method)
 }
 
 // Target provides API functionality for the target object
@@ -135,115 +111,254 @@ type Target struct {
 	TH TurretInterface
 }
 
-// Get loads the target specified by target_name
-func (t *Target) Get(target_name string) (*TurretIOResponse, error) {
+// GetContext loads the target specified by target_name
+func (t *Target) GetContext(ctx context.Context, target_name string) (*TargetRecord, error) {
+	ctx = withOperation(ctx, OPERATION_GET)
 	payload := make(map[string]interface{})
-	url := fmt.Sprintf("%s/%s", TARGET_PATH, target_name)
-	resp, err := t.TH.GetRequest(url, &payload, t.TH.GetHTTPClient())
-	return resp, err
+	url := fmt.Sprintf("%s/%s", TARGET_RESOURCE_PATH, target_name)
+	resp, err := t.TH.GetRequestContext(ctx, url, &payload, t.TH.GetHTTPClient())
+	if err != nil {
+		return nil, err
+	}
+	return newTargetRecord(resp, target_name)
 }
 
-// Create adds a new target specified by the target_name with the attributes specified in attribute_map
+// Get works like GetContext using context.Background()
+func (t *Target) Get(target_name string) (*TargetRecord, error) {
+	return t.GetContext(context.Background(), target_name)
+}
+
+// CreateContext adds a new target specified by the target_name matching the rules in attribute_list,
+// which AttributeList builds and validates.
 // Example:
-// Create("new_target", map[string]string{"location":"west coast", "logins":"10", "premium":"1"})
-func (t *Target) Create(target_name string, attribute_list []map[string]interface {}) (*TurretIOResponse, error) {
+// list, err := AttributeList(Equals("location", "west coast"), GreaterThan("logins", 10), Equals("premium", "1"))
+// Create("new_target", list)
+func (t *Target) CreateContext(ctx context.Context, target_name string, attribute_list []map[string]interface{}) (*TargetRecord, error) {
+	ctx = withOperation(ctx, OPERATION_CREATE)
 	payload := make(map[string]interface{})
 	payload["attributes"] = attribute_list
 
-	url := fmt.Sprintf("%s/%s", TARGET_PATH, target_name)
-	resp, err := t.TH.PostRequest(url, &payload, t.TH.GetHTTPClient())
-	return resp, err
+	url := fmt.Sprintf("%s/%s", TARGET_RESOURCE_PATH, target_name)
+	resp, err := t.TH.PostRequestContext(ctx, url, &payload, t.TH.GetHTTPClient())
+	if err != nil {
+		return nil, err
+	}
+	return newTargetRecord(resp, target_name)
+}
+
+// Create works like CreateContext using context.Background()
+func (t *Target) Create(target_name string, attribute_list []map[string]interface{}) (*TargetRecord, error) {
+	return t.CreateContext(context.Background(), target_name, attribute_list)
 }
 
-// Update updates an existing target specified by the target_name with the attributes specified in the attribute_map.
+// UpdateContext updates an existing target specified by the target_name with the rules in attribute_list.
 // This works just like Create but updates an existing target.
-func (t *Target) Update(target_name string, attribute_list []map[string]interface {}) (*TurretIOResponse, error) {
+func (t *Target) UpdateContext(ctx context.Context, target_name string, attribute_list []map[string]interface{}) (*TargetRecord, error) {
+	ctx = withOperation(ctx, OPERATION_UPDATE)
 	payload := make(map[string]interface{})
 	payload["attributes"] = attribute_list
 
-	url := fmt.Sprintf("%s/%s", TARGET_PATH, target_name)
-	resp, err := t.TH.PostRequest(url, &payload, t.TH.GetHTTPClient())
-	return resp, err
+	url := fmt.Sprintf("%s/%s", TARGET_RESOURCE_PATH, target_name)
+	resp, err := t.TH.PostRequestContext(ctx, url, &payload, t.TH.GetHTTPClient())
+	if err != nil {
+		return nil, err
+	}
+	return newTargetRecord(resp, target_name)
+}
+
+// Update works like UpdateContext using context.Background()
+func (t *Target) Update(target_name string, attribute_list []map[string]interface{}) (*TargetRecord, error) {
+	return t.UpdateContext(context.Background(), target_name, attribute_list)
 }
 
 // TargetEmail provides API functionality for the TargetEmail object
 type TargetEmail struct {
-	TH TurretInterface
+	TH          TurretInterface
+	renderer    *Renderer
+	derivePlain bool
+	linter      *Linter
+}
+
+// TargetEmailOption configures the checks TargetEmail runs on content before Create and Update
+type TargetEmailOption func(*TargetEmail)
+
+// preparedEmail is the content Create and Update send, after the options ran
+type preparedEmail struct {
+	EmailContent
+	derived bool
+	lint    LintIssues
+}
+
+// prepare checks content before it is sent by Create or Update and fills in
+// the parts the options derive
+func (te *TargetEmail) prepare(content EmailContent) (*preparedEmail, error) {
+	p := &preparedEmail{EmailContent: content}
+	if te.derivePlain && strings.TrimSpace(p.Plain) == "" && p.HTML != "" {
+		p.Plain = HTMLToText(p.HTML)
+		p.derived = true
+	}
+	if te.renderer != nil {
+		if problems := te.renderer.Check(p.EmailContent); len(problems) > 0 {
+			return nil, &TemplateError{problems}
+		}
+	}
+	if te.linter != nil {
+		p.lint = te.linter.Lint(p.EmailContent)
+		if err := p.lint.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// newPreparedRecord builds the record of Create and Update, reporting what prepare found
+func newPreparedRecord(resp *TurretIOResponse, target_name string, email_id string, p *preparedEmail) (*TargetEmailRecord, error) {
+	r, err := newTargetEmailRecord(resp, target_name, email_id)
+	if err != nil {
+		return nil, err
+	}
+	if p.derived {
+		r.DerivedPlain = p.Plain
+	}
+	r.LintIssues = p.lint
+	return r, nil
 }
 
-// Get loads the target email specified by the target_name and email_id
-func (te *TargetEmail) Get(target_name string, email_id string) (*TurretIOResponse, error) {
+// GetContext loads the target email specified by the target_name and email_id
+func (te *TargetEmail) GetContext(ctx context.Context, target_name string, email_id string) (*TargetEmailRecord, error) {
+	ctx = withOperation(ctx, OPERATION_GET)
 	payload := make(map[string]interface{})
-	url := fmt.Sprintf("%s/%s/email/%s", TARGET_EMAIL_PATH, target_name, email_id)
-	resp, err := te.TH.GetRequest(url, &payload, te.TH.GetHTTPClient())
-	return resp, err
+	url := fmt.Sprintf("%s/%s/email/%s", TARGET_EMAIL_RESOURCE_PATH, target_name, email_id)
+	resp, err := te.TH.GetRequestContext(ctx, url, &payload, te.TH.GetHTTPClient())
+	if err != nil {
+		return nil, err
+	}
+	return newTargetEmailRecord(resp, target_name, email_id)
+}
+
+// Get works like GetContext using context.Background()
+func (te *TargetEmail) Get(target_name string, email_id string) (*TargetEmailRecord, error) {
+	return te.GetContext(context.Background(), target_name, email_id)
 }
 
-// Create adds a new target email to the target specified by target_name with the subject, html_body, and plain_body provided
-func (te *TargetEmail) Create(target_name string, subject string, html_body string, plain_body string) (*TurretIOResponse, error) {
+// CreateContext adds a new target email to the target specified by target_name with the subject, html_body, and plain_body provided
+func (te *TargetEmail) CreateContext(ctx context.Context, target_name string, subject string, html_body string, plain_body string) (*TargetEmailRecord, error) {
+	ctx = withOperation(ctx, OPERATION_CREATE)
+	content, err := te.prepare(EmailContent{Subject: subject, HTML: html_body, Plain: plain_body})
+	if err != nil {
+		return nil, err
+	}
 	payload := make(map[string]interface{})
-	payload["subject"] = subject
-	payload["html"] = html_body
-	payload["plain"] = plain_body
+	payload["subject"] = content.Subject
+	payload["html"] = content.HTML
+	payload["plain"] = content.Plain
+
+	url := fmt.Sprintf("%s/%s/email", TARGET_EMAIL_RESOURCE_PATH, target_name)
+	// a repeated create would add a duplicate email
+	ctx = withNonIdempotent(ctx)
+	resp, err := te.TH.PostRequestContext(ctx, url, &payload, te.TH.GetHTTPClient())
+	if err != nil {
+		return nil, err
+	}
+	return newPreparedRecord(resp, target_name, "", content)
+}
 
-	url := fmt.Sprintf("%s/%s/email", TARGET_EMAIL_PATH, target_name)
-	resp, err := te.TH.PostRequest(url, &payload, te.TH.GetHTTPClient())
-	return resp, err
+// Create works like CreateContext using context.Background()
+func (te *TargetEmail) Create(target_name string, subject string, html_body string, plain_body string) (*TargetEmailRecord, error) {
+	return te.CreateContext(context.Background(), target_name, subject, html_body, plain_body)
 }
 
-// Update updates an existing target email for the specified target_name based on the provided email_id and sets a new subject, html_body, and plain_body
-func (te *TargetEmail) Update(target_name string, email_id string, subject string, html_body string, plain_body string) (*TurretIOResponse, error) {
+// UpdateContext updates an existing target email for the specified target_name based on the provided email_id and sets a new subject, html_body, and plain_body
+func (te *TargetEmail) UpdateContext(ctx context.Context, target_name string, email_id string, subject string, html_body string, plain_body string) (*TargetEmailRecord, error) {
+	ctx = withOperation(ctx, OPERATION_UPDATE)
+	content, err := te.prepare(EmailContent{Subject: subject, HTML: html_body, Plain: plain_body})
+	if err != nil {
+		return nil, err
+	}
 	payload := make(map[string]interface{})
-	payload["subject"] = subject
-	payload["html"] = html_body
-	payload["plain"] = plain_body
+	payload["subject"] = content.Subject
+	payload["html"] = content.HTML
+	payload["plain"] = content.Plain
+
+	url := fmt.Sprintf("%s/%s/email/%s", TARGET_EMAIL_RESOURCE_PATH, target_name, email_id)
+	resp, err := te.TH.PostRequestContext(ctx, url, &payload, te.TH.GetHTTPClient())
+	if err != nil {
+		return nil, err
+	}
+	return newPreparedRecord(resp, target_name, email_id, content)
+}
 
-	url := fmt.Sprintf("%s/%s/email/%s", TARGET_EMAIL_PATH, target_name, email_id)
-	resp, err := te.TH.PostRequest(url, &payload, te.TH.GetHTTPClient())
-	return resp, err
+// Update works like UpdateContext using context.Background()
+func (te *TargetEmail) Update(target_name string, email_id string, subject string, html_body string, plain_body string) (*TargetEmailRecord, error) {
+	return te.UpdateContext(context.Background(), target_name, email_id, subject, html_body, plain_body)
 }
 
-// SendTest sends a test email to the target specified by target_name with email content from the email specified by email_id.
+// SendTestContext sends a test email to the target specified by target_name with email content from the email specified by email_id.
 // from_email must match a verified sender on the account and the test email is sent to the address specified in recipient
-func (te *TargetEmail) SendTest(target_name string, email_id string, from_email string, recipient string) (*TurretIOResponse, error) {
+func (te *TargetEmail) SendTestContext(ctx context.Context, target_name string, email_id string, from_email string, recipient string) (*TurretIOResponse, error) {
+	ctx = withOperation(ctx, OPERATION_SEND_TEST)
 	payload := make(map[string]interface{})
 	payload["email_from"] = from_email
 	payload["recipient"] = recipient
 
-	url := fmt.Sprintf("%s/%s/email/%s/sendTestEmail", TARGET_EMAIL_PATH, target_name, email_id)
-	resp, err := te.TH.PostRequest(url, &payload, te.TH.GetHTTPClient())
+	url := fmt.Sprintf("%s/%s/email/%s/sendTestEmail", TARGET_EMAIL_RESOURCE_PATH, target_name, email_id)
+	ctx = withNonIdempotent(ctx)
+	resp, err := te.TH.PostRequestContext(ctx, url, &payload, te.TH.GetHTTPClient())
 	return resp, err
 }
 
-// Send sends an email to the target specified by target_name with email content from the email specified by email_id.
+// SendTest works like SendTestContext using context.Background()
+func (te *TargetEmail) SendTest(target_name string, email_id string, from_email string, recipient string) (*TurretIOResponse, error) {
+	return te.SendTestContext(context.Background(), target_name, email_id, from_email, recipient)
+}
+
+// SendContext sends an email to the target specified by target_name with email content from the email specified by email_id.
 // from_email must match a verified sender on the account.
-func (te *TargetEmail) Send(target_name string, email_id string, from_email string) (*TurretIOResponse, error) {
+// Send is only retried when the RetryPolicy sets RetryNonIdempotent.
+func (te *TargetEmail) SendContext(ctx context.Context, target_name string, email_id string, from_email string) (*TurretIOResponse, error) {
+	ctx = withOperation(ctx, OPERATION_SEND)
 	payload := make(map[string]interface{})
 	payload["email_from"] = from_email
 
-	url := fmt.Sprintf("%s/%s/email/%s/send", TARGET_EMAIL_PATH, target_name, email_id)
-	resp, err := te.TH.PostRequest(url, &payload, te.TH.GetHTTPClient())
+	url := fmt.Sprintf("%s/%s/email/%s/send", TARGET_EMAIL_RESOURCE_PATH, target_name, email_id)
+	ctx = withNonIdempotent(ctx)
+	resp, err := te.TH.PostRequestContext(ctx, url, &payload, te.TH.GetHTTPClient())
 	return resp, err
 }
 
+// Send works like SendContext using context.Background()
+func (te *TargetEmail) Send(target_name string, email_id string, from_email string) (*TurretIOResponse, error) {
+	return te.SendContext(context.Background(), target_name, email_id, from_email)
+}
+
 // User provides API functionality for the user object
 type User struct {
 	TH TurretInterface
 }
 
-// Get loads a user by email address
-func (u *User) Get(email string) (*TurretIOResponse, error) {
+// GetContext loads a user by email address
+func (u *User) GetContext(ctx context.Context, email string) (*UserRecord, error) {
+	ctx = withOperation(ctx, OPERATION_GET)
 	payload := make(map[string]interface{})
 
-	url := fmt.Sprintf("%s/%s", USER_PATH, email)
-	resp, err := u.TH.GetRequest(url, &payload, u.TH.GetHTTPClient())
-	return resp, err
+	url := fmt.Sprintf("%s/%s", USER_RESOURCE_PATH, email)
+	resp, err := u.TH.GetRequestContext(ctx, url, &payload, u.TH.GetHTTPClient())
+	if err != nil {
+		return nil, err
+	}
+	return newUserRecord(resp, email)
+}
+
+// Get works like GetContext using context.Background()
+func (u *User) Get(email string) (*UserRecord, error) {
+	return u.GetContext(context.Background(), email)
 }
 
-// Set updates an existing user or creates a new user with the email address specified.
-// attribute_map is used to set all attributes for the user and classifies the user into matching targets
+// SetContext updates an existing user or creates a new user with the email address specified.
+// attribute_map is used to set all attributes for the user and classifies the user into matching targets (MatchingTargets predicts which)
 // property_map is used to set extra data for the user that's accessible when drafting emails, but not used to classify the user into targets
-func (u *User) Set(email string, attribute_map map[string]string, property_map map[string]string) (*TurretIOResponse, error) {
+func (u *User) SetContext(ctx context.Context, email string, attribute_map map[string]string, property_map map[string]string) (*UserRecord, error) {
+	ctx = withOperation(ctx, OPERATION_SET)
 	payload := make(map[string]interface{})
 	for k, v := range attribute_map {
 		payload[k] = v
@@ -255,8 +370,16 @@ func (u *User) Set(email string, attribute_map map[string]string, property_map m
 		}
 		payload["properties"] = properties
 	}
-	url := fmt.Sprintf("%s/%s", USER_PATH, email)
-	resp, err := u.TH.PostRequest(url, &payload, u.TH.GetHTTPClient())
-	return resp, err
+	url := fmt.Sprintf("%s/%s", USER_RESOURCE_PATH, email)
+	resp, err := u.TH.PostRequestContext(ctx, url, &payload, u.TH.GetHTTPClient())
+	if err != nil {
+		return nil, err
+	}
+	return newUserRecord(resp, email)
+}
+
+// Set works like SetContext using context.Background()
+func (u *User) Set(email string, attribute_map map[string]string, property_map map[string]string) (*UserRecord, error) {
+	return u.SetContext(context.Background(), email, attribute_map, property_map)
 }
 
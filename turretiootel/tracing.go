@@ -0,0 +1,141 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package turretiootel traces the calls made by a turretIO client with
+// OpenTelemetry:
+//
+//	turret := turretIO.NewTurretIOWithOptions(key, secret, turretiootel.WithTracing())
+//
+// Every User, Target, TargetEmail and Account method creates a client span,
+// child of the span in its context, named after its resource and operation,
+// e.g. "turretIO target_email.send". The span context is propagated to
+// Turret.IO in the request headers.
+//
+// The package is a module of its own, so that the turretIO module does not
+// depend on OpenTelemetry.
+package turretiootel
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+
+	"github.com/turretIO/turret-io-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// INSTRUMENTATION_NAME names the tracer creating the spans
+const INSTRUMENTATION_NAME = "github.com/turretIO/turret-io-go/turretiootel"
+
+// Span attributes, besides http.request.method and http.response.status_code
+const ATTRIBUTE_RESOURCE = "turretio.resource"
+const ATTRIBUTE_OPERATION = "turretio.operation"
+const ATTRIBUTE_TARGET = "turretio.target"
+const ATTRIBUTE_EMAIL_ID_HASH = "turretio.email_id.hash"
+const ATTRIBUTE_ATTEMPTS = "turretio.attempts"
+
+type config struct {
+	provider   trace.TracerProvider
+	propagator propagation.TextMapPropagator
+}
+
+// Option configures the tracing middleware
+type Option func(*config)
+
+// WithTracerProvider creates spans with provider instead of the global one
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(c *config) {
+		c.provider = provider
+	}
+}
+
+// WithPropagator injects the span context with propagator instead of the global one
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(c *config) {
+		c.propagator = propagator
+	}
+}
+
+// WithTracing traces the calls of a TurretIO, see Middleware
+func WithTracing(opts ...Option) turretIO.Option {
+	return turretIO.WithMiddleware(Middleware(opts...))
+}
+
+// Middleware returns a turretIO.Middleware creating a span for every call,
+// including its retries. The span records the resource, operation, target
+// name, a hash of the target email ID, the HTTP status and the error, if any.
+// Email addresses, which appear in user paths, are not recorded.
+func Middleware(opts ...Option) turretIO.Middleware {
+	c := &config{
+		provider:   otel.GetTracerProvider(),
+		propagator: otel.GetTextMapPropagator(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	tracer := c.provider.Tracer(INSTRUMENTATION_NAME)
+
+	return func(next turretIO.Handler) turretIO.Handler {
+		return func(ctx context.Context, call *turretIO.Call) (*turretIO.TurretIOResponse, error) {
+			name := "turretIO " + call.Resource
+			if call.Operation != "" {
+				name += "." + call.Operation
+			}
+			attrs := []attribute.KeyValue{
+				attribute.String(ATTRIBUTE_RESOURCE, call.Resource),
+				attribute.String("http.request.method", call.Method),
+			}
+			if call.Operation != "" {
+				attrs = append(attrs, attribute.String(ATTRIBUTE_OPERATION, call.Operation))
+			}
+			if call.Target != "" {
+				attrs = append(attrs, attribute.String(ATTRIBUTE_TARGET, call.Target))
+			}
+			if call.EmailID != "" {
+				attrs = append(attrs, attribute.String(ATTRIBUTE_EMAIL_ID_HASH, hashID(call.EmailID)))
+			}
+			ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+			defer span.End()
+
+			c.propagator.Inject(ctx, propagation.HeaderCarrier(call.Header))
+			resp, err := next(ctx, call)
+
+			span.SetAttributes(attribute.Int(ATTRIBUTE_ATTEMPTS, call.Attempts))
+			var apiErr *turretIO.APIError
+			switch {
+			case resp != nil:
+				span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+			case errors.As(err, &apiErr):
+				span.SetAttributes(attribute.Int("http.response.status_code", apiErr.StatusCode))
+			}
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			return resp, err
+		}
+	}
+}
+
+// hashID returns the first 16 hex digits of the SHA-256 of id, enough to
+// tell emails apart in traces without exposing their IDs
+func hashID(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,107 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretiootel_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/turretIO/turret-io-go"
+	"github.com/turretIO/turret-io-go/turretiootel"
+	"github.com/turretIO/turret-io-go/turretiotest"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const VALID_API_KEY = "dmFsaWQ="
+const VALID_API_SECRET = "c2VjcmV0"
+const EMAIL_TEST = "test@example.com"
+const TARGET_NAME = "eastwest"
+
+func TestTracing(t *testing.T) {
+	srv := turretiotest.NewServer()
+	defer srv.Close()
+	srv.AddCredentials(VALID_API_KEY, VALID_API_SECRET)
+	srv.SetTargetEmail(TARGET_NAME, "abc", "Hello", "<p>Hi</p>", "Hi")
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	turret := srv.Client(VALID_API_KEY, VALID_API_SECRET, turretiootel.WithTracing(
+		turretiootel.WithTracerProvider(provider),
+		turretiootel.WithPropagator(propagation.TraceContext{})))
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+	if _, err := turretIO.NewTargetEmail(turret).SendContext(ctx, TARGET_NAME, "abc", "from@example.com"); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if _, err := turretIO.NewUser(turret).GetContext(ctx, EMAIL_TEST); err == nil {
+		t.Fatalf("Get of a missing user should fail")
+	}
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("Expected 3 spans, got %d", len(spans))
+	}
+	send, get := spans[0], spans[1]
+	if send.Name() != "turretIO target_email.send" || send.SpanKind() != trace.SpanKindClient {
+		t.Errorf("Unexpected span %s of kind %s", send.Name(), send.SpanKind())
+	}
+	if send.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("Span should be a child of the span in the context")
+	}
+	attrs := make(map[string]string)
+	for _, kv := range send.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	want := map[string]string{
+		turretiootel.ATTRIBUTE_RESOURCE:  turretIO.RESOURCE_TARGET_EMAIL,
+		turretiootel.ATTRIBUTE_OPERATION: turretIO.OPERATION_SEND,
+		turretiootel.ATTRIBUTE_TARGET:    TARGET_NAME,
+		turretiootel.ATTRIBUTE_ATTEMPTS:  "1",
+		"http.request.method":            "POST",
+		"http.response.status_code":      "200",
+	}
+	for k, v := range want {
+		if attrs[k] != v {
+			t.Errorf("Attribute %s = %q, want %q", k, attrs[k], v)
+		}
+	}
+	if hash := attrs[turretiootel.ATTRIBUTE_EMAIL_ID_HASH]; len(hash) != 16 || strings.Contains(hash, "abc") {
+		t.Errorf("Unexpected email ID hash %q", hash)
+	}
+
+	if get.Status().Code != codes.Error || len(get.Events()) != 1 || get.Events()[0].Name != "exception" {
+		t.Errorf("Failed call should record its error, got status %v and events %v", get.Status(), get.Events())
+	}
+	for _, kv := range get.Attributes() {
+		if strings.Contains(kv.Value.Emit(), EMAIL_TEST) {
+			t.Errorf("Span should not record the user email, got %s=%s", kv.Key, kv.Value.Emit())
+		}
+	}
+
+	calls := srv.CallsTo("POST", turretIO.TARGET_EMAIL_RESOURCE_PATH+"/"+TARGET_NAME+"/email/abc/send")
+	if len(calls) != 1 {
+		t.Fatalf("Expected 1 send call, got %d", len(calls))
+	}
+	traceparent := calls[0].Header.Get("Traceparent")
+	if !strings.Contains(traceparent, send.SpanContext().SpanID().String()) {
+		t.Errorf("Request should carry the span context, got traceparent %q", traceparent)
+	}
+}
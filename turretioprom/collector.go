@@ -0,0 +1,138 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package turretioprom exposes Prometheus metrics for the calls made by a
+// turretIO client:
+//
+//	collector := turretioprom.NewCollector()
+//	prometheus.MustRegister(collector)
+//	turret := turretIO.NewTurretIOWithOptions(key, secret, turretioprom.WithCollector(collector))
+//
+// Every metric is labeled by resource (user, target, target_email, account),
+// operation (get, set, create, update, send, send_test) and status class
+// (2xx, 4xx, 5xx, or "error" when no response was received).
+//
+// The package is a module of its own, so that the turretIO module does not
+// depend on the Prometheus client.
+package turretioprom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/turretIO/turret-io-go"
+)
+
+const NAMESPACE = "turretio"
+
+// STATUS_CLASS_ERROR labels calls that got no response, e.g. on network
+// errors, canceled contexts or rate limiting with fail fast
+const STATUS_CLASS_ERROR = "error"
+
+// OPERATION_OTHER labels calls made with GetRequest or PostRequest directly
+const OPERATION_OTHER = "other"
+
+var labels = []string{"resource", "operation", "status_class"}
+
+// Collector counts and times API calls. It is a prometheus.Collector, to be
+// registered with a prometheus.Registerer, and is plugged into a TurretIO with
+// WithCollector or as Middleware. One Collector can serve several clients.
+type Collector struct {
+	requests *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+}
+
+// NewCollector creates a Collector with the default latency buckets
+func NewCollector() *Collector {
+	return NewCollectorWithBuckets(prometheus.DefBuckets)
+}
+
+// NewCollectorWithBuckets creates a Collector with the given latency buckets, in seconds
+func NewCollectorWithBuckets(buckets []float64) *Collector {
+	return &Collector{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: NAMESPACE,
+			Name:      "requests_total",
+			Help:      "Turret.IO API calls, retries included in a single call.",
+		}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: NAMESPACE,
+			Name:      "errors_total",
+			Help:      "Turret.IO API calls that returned an error.",
+		}, labels),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: NAMESPACE,
+			Name:      "request_duration_seconds",
+			Help:      "Latency of Turret.IO API calls, retries included.",
+			Buckets:   buckets,
+		}, labels),
+	}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.requests.Describe(ch)
+	c.errors.Describe(ch)
+	c.latency.Describe(ch)
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.requests.Collect(ch)
+	c.errors.Collect(ch)
+	c.latency.Collect(ch)
+}
+
+// Middleware returns the turretIO.Middleware recording calls in c
+func (c *Collector) Middleware() turretIO.Middleware {
+	return func(next turretIO.Handler) turretIO.Handler {
+		return func(ctx context.Context, call *turretIO.Call) (*turretIO.TurretIOResponse, error) {
+			start := time.Now()
+			resp, err := next(ctx, call)
+			c.observe(call, resp, err, time.Since(start))
+			return resp, err
+		}
+	}
+}
+
+func (c *Collector) observe(call *turretIO.Call, resp *turretIO.TurretIOResponse, err error, latency time.Duration) {
+	operation := call.Operation
+	if operation == "" {
+		operation = OPERATION_OTHER
+	}
+	values := []string{call.Resource, operation, statusClass(resp, err)}
+	c.requests.WithLabelValues(values...).Inc()
+	c.latency.WithLabelValues(values...).Observe(latency.Seconds())
+	if err != nil {
+		c.errors.WithLabelValues(values...).Inc()
+	}
+}
+
+// WithCollector records the calls of a TurretIO in c
+func WithCollector(c *Collector) turretIO.Option {
+	return turretIO.WithMiddleware(c.Middleware())
+}
+
+func statusClass(resp *turretIO.TurretIOResponse, err error) string {
+	var apiErr *turretIO.APIError
+	switch {
+	case resp != nil:
+		return fmt.Sprintf("%dxx", resp.StatusCode/100)
+	case errors.As(err, &apiErr):
+		return fmt.Sprintf("%dxx", apiErr.StatusCode/100)
+	}
+	return STATUS_CLASS_ERROR
+}
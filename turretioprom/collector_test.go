@@ -0,0 +1,106 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretioprom_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/turretIO/turret-io-go"
+	"github.com/turretIO/turret-io-go/turretioprom"
+	"github.com/turretIO/turret-io-go/turretiotest"
+)
+
+const VALID_API_KEY = "dmFsaWQ="
+const VALID_API_SECRET = "c2VjcmV0"
+const EMAIL_TEST = "test@example.com"
+const TARGET_NAME = "eastwest"
+
+func TestPrometheusCollector(t *testing.T) {
+	srv := turretiotest.NewServer()
+	defer srv.Close()
+	srv.AddCredentials(VALID_API_KEY, VALID_API_SECRET)
+	srv.SetTargetEmail(TARGET_NAME, "abc", "Hello", "<p>Hi</p>", "Hi")
+
+	collector := turretioprom.NewCollector()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+	turret := srv.Client(VALID_API_KEY, VALID_API_SECRET, turretioprom.WithCollector(collector))
+
+	user := turretIO.NewUser(turret)
+	for i := 0; i < 3; i++ {
+		if _, err := user.Set(EMAIL_TEST, map[string]string{"location": "midwest"}, nil); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	if _, err := turretIO.NewTargetEmail(turret).Send(TARGET_NAME, "abc", "from@example.com"); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if _, err := turretIO.NewTarget(turret).Get("missing"); err == nil {
+		t.Fatalf("Get of a missing target should fail")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := user.GetContext(ctx, EMAIL_TEST); err == nil {
+		t.Fatalf("Get with a canceled context should fail")
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %v", err)
+	}
+	// metric returns the counter or histogram sample count of the series with labels
+	metric := func(name string, labels ...string) float64 {
+		for _, f := range families {
+			if f.GetName() != name {
+				continue
+			}
+			for _, m := range f.GetMetric() {
+				got := make(map[string]string)
+				for _, l := range m.GetLabel() {
+					got[l.GetName()] = l.GetValue()
+				}
+				if got["resource"] != labels[0] || got["operation"] != labels[1] || got["status_class"] != labels[2] {
+					continue
+				}
+				if h := m.GetHistogram(); h != nil {
+					return float64(h.GetSampleCount())
+				}
+				return m.GetCounter().GetValue()
+			}
+		}
+		return 0
+	}
+
+	tests := []struct {
+		name   string
+		labels []string
+		want   float64
+	}{
+		{"turretio_requests_total", []string{turretIO.RESOURCE_USER, turretIO.OPERATION_SET, "2xx"}, 3},
+		{"turretio_request_duration_seconds", []string{turretIO.RESOURCE_USER, turretIO.OPERATION_SET, "2xx"}, 3},
+		{"turretio_errors_total", []string{turretIO.RESOURCE_USER, turretIO.OPERATION_SET, "2xx"}, 0},
+		{"turretio_requests_total", []string{turretIO.RESOURCE_TARGET_EMAIL, turretIO.OPERATION_SEND, "2xx"}, 1},
+		{"turretio_requests_total", []string{turretIO.RESOURCE_TARGET, turretIO.OPERATION_GET, "4xx"}, 1},
+		{"turretio_errors_total", []string{turretIO.RESOURCE_TARGET, turretIO.OPERATION_GET, "4xx"}, 1},
+		{"turretio_errors_total", []string{turretIO.RESOURCE_USER, turretIO.OPERATION_GET, turretioprom.STATUS_CLASS_ERROR}, 1},
+	}
+	for _, tt := range tests {
+		if got := metric(tt.name, tt.labels...); got != tt.want {
+			t.Errorf("%s%v = %v, want %v", tt.name, tt.labels, got, tt.want)
+		}
+	}
+}
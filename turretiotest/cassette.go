@@ -0,0 +1,255 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretiotest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/turretIO/turret-io-go"
+)
+
+// ErrCassetteMiss is returned when a replayed request matches no recorded one
+var ErrCassetteMiss = errors.New("turretiotest: no recorded interaction")
+
+// Interaction is a recorded request and its response
+type Interaction struct {
+	Method string `json:"method"`
+	// Path is the URL path, API version included
+	Path string `json:"path"`
+	// Payload is the decoded JSON payload, secrets replaced by turretIO.REDACTED
+	Payload json.RawMessage `json:"payload,omitempty"`
+	// RequestHeader has the key and signature replaced by turretIO.REDACTED
+	RequestHeader http.Header `json:"request_header,omitempty"`
+
+	StatusCode int         `json:"status_code"`
+	Status     string      `json:"status"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body"`
+}
+
+// Cassette is an http.RoundTripper recording Turret.IO exchanges to a file
+// and replaying them later without network access. Requests are matched on
+// method, path and decoded payload, not on the signature headers, which
+// change with every request.
+//
+//	var cassette *turretiotest.Cassette
+//	if *record {
+//		cassette = turretiotest.RecordCassette("testdata/user.json", nil)
+//		defer cassette.Save()
+//	} else if cassette, err = turretiotest.LoadCassette("testdata/user.json"); err != nil {
+//		t.Fatal(err)
+//	}
+//	turret := turretIO.NewTurretIOWithOptions(key, secret, turretIO.WithHTTPClient(cassette.Client()))
+//
+// Recorded files hold no API key or signature, and the secrets of payloads
+// and JSON response bodies are redacted as with turretIO.RedactPayload.
+type Cassette struct {
+	path      string
+	recording bool
+	transport http.RoundTripper
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// RecordCassette creates a Cassette sending requests through transport,
+// http.DefaultTransport if nil, and recording them until Save writes them to path
+func RecordCassette(path string, transport http.RoundTripper) *Cassette {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &Cassette{path: path, recording: true, transport: transport}
+}
+
+// LoadCassette creates a Cassette replaying the interactions saved at path.
+// Each interaction is replayed once, identical requests getting the
+// responses recorded for them in order.
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Interactions []Interaction `json:"interactions"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("turretiotest: reading cassette %s: %w", path, err)
+	}
+	// payloads are compared as compact JSON, Save indents them
+	for i, in := range file.Interactions {
+		if len(in.Payload) > 0 {
+			var b bytes.Buffer
+			if err := json.Compact(&b, in.Payload); err != nil {
+				return nil, fmt.Errorf("turretiotest: reading cassette %s: %w", path, err)
+			}
+			file.Interactions[i].Payload = b.Bytes()
+		}
+	}
+	return &Cassette{path: path, interactions: file.Interactions, used: make([]bool, len(file.Interactions))}, nil
+}
+
+// Client returns an http.Client using the Cassette, for turretIO.WithHTTPClient
+func (c *Cassette) Client() *http.Client {
+	return &http.Client{Transport: c}
+}
+
+// Interactions returns the interactions recorded or loaded so far
+func (c *Cassette) Interactions() []Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Interaction(nil), c.interactions...)
+}
+
+// Save writes the recorded interactions to the path of the Cassette,
+// creating its directory if needed
+func (c *Cassette) Save() error {
+	if !c.recording {
+		return errors.New("turretiotest: cassette is replaying")
+	}
+	c.mu.Lock()
+	data, err := json.MarshalIndent(map[string]interface{}{"interactions": c.interactions}, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, append(data, '\n'), 0644)
+}
+
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	payload := decodePayload(body)
+	if c.recording {
+		return c.record(req, body, payload)
+	}
+	return c.replay(req, payload)
+}
+
+func (c *Cassette) record(req *http.Request, body []byte, payload json.RawMessage) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	resp, err := c.transport.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	header := turretIO.RedactHeader(req.Header)
+	header.Del("X-Ls-Time")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.interactions = append(c.interactions, Interaction{
+		Method:        req.Method,
+		Path:          req.URL.Path,
+		Payload:       payload,
+		RequestHeader: header,
+		StatusCode:    resp.StatusCode,
+		Status:        resp.Status,
+		Header:        resp.Header.Clone(),
+		Body:          scrubBody(respBody),
+	})
+	return resp, nil
+}
+
+func (c *Cassette) replay(req *http.Request, payload json.RawMessage) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, in := range c.interactions {
+		if c.used[i] || in.Method != req.Method || in.Path != req.URL.Path || !bytes.Equal(in.Payload, payload) {
+			continue
+		}
+		c.used[i] = true
+		header := in.Header.Clone()
+		if header == nil {
+			header = make(http.Header)
+		}
+		// the recorded length may not match the scrubbed body
+		header.Set("Content-Length", strconv.Itoa(len(in.Body)))
+		return &http.Response{
+			StatusCode:    in.StatusCode,
+			Status:        in.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader([]byte(in.Body))),
+			ContentLength: int64(len(in.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w for %s %s with payload %s", ErrCassetteMiss, req.Method, req.URL.Path, payload)
+}
+
+// decodePayload returns the base64 encoded JSON body of a request as
+// canonical JSON with secrets redacted, so that equal payloads compare equal
+func decodePayload(body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(string(body))
+	if err != nil {
+		raw = body
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		// not JSON, keep it verbatim
+		out, _ := json.Marshal(string(raw))
+		return out
+	}
+	if m, ok := v.(map[string]interface{}); ok {
+		v = turretIO.RedactPayload(m)
+	}
+	out, _ := json.Marshal(v)
+	return out
+}
+
+// scrubBody redacts the secrets of a JSON object response body
+func scrubBody(body []byte) string {
+	var m map[string]interface{}
+	if err := json.Unmarshal(body, &m); err != nil {
+		return string(body)
+	}
+	out, err := json.Marshal(turretIO.RedactPayload(m))
+	if err != nil {
+		return string(body)
+	}
+	return string(out)
+}
@@ -0,0 +1,277 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretiotest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"sync"
+	"testing"
+
+	"github.com/turretIO/turret-io-go"
+)
+
+// ErrNoResponse is returned by Mock for calls no response was programmed for
+var ErrNoResponse = errors.New("turretiotest: no response programmed")
+
+// MockCall is a call made through a Mock
+type MockCall struct {
+	Method string
+	// Path is the url passed to GetRequest or PostRequest, e.g. /user/test@example.com
+	Path string
+	// Payload is the payload as the API would decode it from JSON
+	Payload map[string]interface{}
+}
+
+type mockRule struct {
+	method  string
+	pattern string
+	handle  func(call MockCall) (*turretIO.TurretIOResponse, error)
+}
+
+// Mock is an in-memory turretIO.TurretInterface for unit tests of code using
+// NewUser, NewTarget, NewTargetEmail and NewAccount. It makes no HTTP calls:
+// it records every call and answers with the responses programmed for its
+// method and path.
+//
+//	mock := turretiotest.NewMock()
+//	mock.Respond("GET", "/user/*", 200, map[string]interface{}{"email": "test@example.com"})
+//	mock.Respond("POST", "/target/*/email/*/send", 500, nil)
+//	...
+//	mock.AssertCalled(t, "GET", "/user/test@example.com")
+//
+// Path patterns use the syntax of path.Match, a * never matches a /.
+// A Mock is safe for concurrent use.
+type Mock struct {
+	// Apikey and Apisecret are returned by GetApikey and GetApisecret
+	Apikey    string
+	Apisecret string
+
+	mu    sync.Mutex
+	rules []mockRule
+	calls []MockCall
+}
+
+// NewMock creates a Mock with no programmed responses
+func NewMock() *Mock {
+	return &Mock{Apikey: "mock", Apisecret: "bW9jaw=="}
+}
+
+// Handle answers calls matching method and pattern with fn. An empty method
+// matches any. When several rules match, the one added last wins, so tests
+// can override responses set up in common code.
+func (m *Mock) Handle(method string, pattern string, fn func(call MockCall) (*turretIO.TurretIOResponse, error)) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		panic(fmt.Sprintf("turretiotest: bad path pattern %q: %s", pattern, err))
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rules = append(m.rules, mockRule{method: method, pattern: pattern, handle: fn})
+}
+
+// Respond answers calls matching method and pattern with status and body,
+// the body going through JSON as a real response would. A non-2xx status is
+// returned as a *turretIO.APIError, so errors.Is(err, turretIO.ErrNotFound)
+// works as with the real API.
+func (m *Mock) Respond(method string, pattern string, status int, body map[string]interface{}) {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		panic(fmt.Sprintf("turretiotest: encoding response: %s", err))
+	}
+	m.Handle(method, pattern, func(call MockCall) (*turretIO.TurretIOResponse, error) {
+		var decoded map[string]interface{}
+		json.Unmarshal(raw, &decoded)
+		if status < 200 || status > 299 {
+			return nil, &turretIO.APIError{
+				StatusCode: status,
+				Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+				Method:     call.Method,
+				Path:       call.Path,
+				Body:       decoded,
+				RawBody:    raw,
+				Header:     make(http.Header),
+			}
+		}
+		return &turretIO.TurretIOResponse{
+			JSONBody:   decoded,
+			Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+			StatusCode: status,
+			Header:     make(http.Header),
+		}, nil
+	})
+}
+
+// Fail answers calls matching method and pattern with err, e.g. to simulate
+// network errors
+func (m *Mock) Fail(method string, pattern string, err error) {
+	m.Handle(method, pattern, func(call MockCall) (*turretIO.TurretIOResponse, error) {
+		return nil, err
+	})
+}
+
+// Calls returns every call made so far, in order
+func (m *Mock) Calls() []MockCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]MockCall(nil), m.calls...)
+}
+
+// CallsTo returns the calls matching method and pattern
+func (m *Mock) CallsTo(method string, pattern string) []MockCall {
+	var calls []MockCall
+	for _, c := range m.Calls() {
+		if matches(method, pattern, c) {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Reset forgets recorded calls and programmed responses
+func (m *Mock) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rules = nil
+	m.calls = nil
+}
+
+// AssertCalled fails t unless a call matching method and pattern was made
+func (m *Mock) AssertCalled(t testing.TB, method string, pattern string) {
+	t.Helper()
+	if len(m.CallsTo(method, pattern)) == 0 {
+		t.Errorf("expected a call to %s %s, got %s", method, pattern, m.describeCalls())
+	}
+}
+
+// AssertNotCalled fails t if a call matching method and pattern was made
+func (m *Mock) AssertNotCalled(t testing.TB, method string, pattern string) {
+	t.Helper()
+	if n := len(m.CallsTo(method, pattern)); n > 0 {
+		t.Errorf("expected no call to %s %s, got %d", method, pattern, n)
+	}
+}
+
+// AssertCallCount fails t unless exactly n calls matching method and pattern were made
+func (m *Mock) AssertCallCount(t testing.TB, method string, pattern string, n int) {
+	t.Helper()
+	if got := len(m.CallsTo(method, pattern)); got != n {
+		t.Errorf("expected %d calls to %s %s, got %d", n, method, pattern, got)
+	}
+}
+
+// AssertPayload fails t unless the last call matching method and pattern had
+// the payload want, compared as JSON so that e.g. map[string]string values
+// and numbers of any type can be used
+func (m *Mock) AssertPayload(t testing.TB, method string, pattern string, want map[string]interface{}) {
+	t.Helper()
+	calls := m.CallsTo(method, pattern)
+	if len(calls) == 0 {
+		t.Errorf("expected a call to %s %s, got %s", method, pattern, m.describeCalls())
+		return
+	}
+	got, _ := json.Marshal(calls[len(calls)-1].Payload)
+	expected, err := json.Marshal(want)
+	if err != nil {
+		t.Fatalf("encoding expected payload: %s", err)
+	}
+	if !bytes.Equal(got, expected) {
+		t.Errorf("payload of %s %s:\n got %s\nwant %s", method, pattern, got, expected)
+	}
+}
+
+func (m *Mock) describeCalls() string {
+	calls := m.Calls()
+	if len(calls) == 0 {
+		return "no calls"
+	}
+	var b bytes.Buffer
+	for _, c := range calls {
+		fmt.Fprintf(&b, "\n\t%s %s", c.Method, c.Path)
+	}
+	return b.String()
+}
+
+func matches(method string, pattern string, call MockCall) bool {
+	if method != "" && method != call.Method {
+		return false
+	}
+	ok, _ := path.Match(pattern, call.Path)
+	return ok
+}
+
+func (m *Mock) do(ctx context.Context, method string, url string, payload *map[string]interface{}) (*turretIO.TurretIOResponse, error) {
+	call := MockCall{Method: method, Path: url}
+	if payload != nil {
+		raw, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		json.Unmarshal(raw, &call.Payload)
+	}
+
+	m.mu.Lock()
+	m.calls = append(m.calls, call)
+	var handle func(call MockCall) (*turretIO.TurretIOResponse, error)
+	for i := len(m.rules) - 1; i >= 0; i-- {
+		if matches(m.rules[i].method, m.rules[i].pattern, call) {
+			handle = m.rules[i].handle
+			break
+		}
+	}
+	m.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if handle == nil {
+		return nil, fmt.Errorf("%w for %s %s", ErrNoResponse, method, url)
+	}
+	return handle(call)
+}
+
+func (m *Mock) GetHTTPClient() *http.Client {
+	return http.DefaultClient
+}
+
+func (m *Mock) GetRequest(url string, payload *map[string]interface{}, client *http.Client) (*turretIO.TurretIOResponse, error) {
+	return m.do(context.Background(), "GET", url, payload)
+}
+
+func (m *Mock) PostRequest(url string, payload *map[string]interface{}, client *http.Client) (*turretIO.TurretIOResponse, error) {
+	return m.do(context.Background(), "POST", url, payload)
+}
+
+func (m *Mock) GetRequestContext(ctx context.Context, url string, payload *map[string]interface{}, client *http.Client) (*turretIO.TurretIOResponse, error) {
+	return m.do(ctx, "GET", url, payload)
+}
+
+func (m *Mock) PostRequestContext(ctx context.Context, url string, payload *map[string]interface{}, client *http.Client) (*turretIO.TurretIOResponse, error) {
+	return m.do(ctx, "POST", url, payload)
+}
+
+func (m *Mock) GetApikey() string {
+	return m.Apikey
+}
+
+func (m *Mock) GetApisecret() string {
+	return m.Apisecret
+}
+
+var _ turretIO.TurretInterface = (*Mock)(nil)
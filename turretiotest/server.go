@@ -0,0 +1,351 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package turretiotest provides an in-memory Turret.IO API server for tests.
+//
+// The server implements the user, target, target email and account endpoints,
+// checks request signatures with turretIO.Verifier and records every
+// call so tests can assert on them:
+//
+//	srv := turretiotest.NewServer()
+//	defer srv.Close()
+//	srv.AddCredentials("key", "c2VjcmV0")
+//	user := turretIO.NewUser(srv.Client("key", "c2VjcmV0"))
+//
+// Code that only needs a turretIO.TurretInterface can be tested without HTTP
+// with a Mock, which answers with programmed responses instead. Exchanges with
+// the real API can be recorded and replayed with a Cassette.
+package turretiotest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/turretIO/turret-io-go"
+)
+
+// Call is a request received by the Server
+type Call struct {
+	Method  string
+	Path    string
+	Payload map[string]interface{}
+	Header  http.Header
+	// StatusCode is the status the Server answered with
+	StatusCode int
+}
+
+// Server is a fake Turret.IO API backed by an httptest.Server
+type Server struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	verifier    *turretIO.Verifier
+	apiVersion  string
+	credentials map[string]string
+	users       map[string]map[string]interface{}
+	targets     map[string]map[string]interface{}
+	emails      map[string]map[string]map[string]interface{}
+	account     map[string]interface{}
+	calls       []Call
+	nextID      int
+}
+
+// NewServer starts a Server serving the turretIO.DEFAULT_API_VERSION API.
+// It must be closed with Close when done.
+func NewServer() *Server {
+	s := &Server{
+		apiVersion:  turretIO.DEFAULT_API_VERSION,
+		credentials: make(map[string]string),
+		users:       make(map[string]map[string]interface{}),
+		targets:     make(map[string]map[string]interface{}),
+		emails:      make(map[string]map[string]map[string]interface{}),
+		account: map[string]interface{}{
+			"outgoing_method": map[string]interface{}{"type": turretIO.OUTGOING_METHOD_TURRET_IO_NAME},
+		},
+	}
+	// clients may legitimately send identical requests within one second
+	s.verifier = &turretIO.Verifier{Lookup: s.lookupSecret, DisableReplayCheck: true}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// AddCredentials registers an API key and its base64 encoded secret.
+// Requests signed with any other key are answered with 401 Unauthorized.
+func (s *Server) AddCredentials(api_key string, api_secret string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.credentials[api_key] = api_secret
+}
+
+// Client returns a TurretIO pointed at the Server
+func (s *Server) Client(api_key string, api_secret string, opts ...turretIO.Option) *turretIO.TurretIO {
+	opts = append([]turretIO.Option{turretIO.WithBaseURL(s.URL), turretIO.WithHTTPClient(s.Server.Client())}, opts...)
+	return turretIO.NewTurretIOWithOptions(api_key, api_secret, opts...)
+}
+
+// Calls returns every request received so far, in order
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Call(nil), s.calls...)
+}
+
+// CallsTo returns the requests received for method and resource path,
+// e.g. CallsTo("POST", "/user/test@example.com")
+func (s *Server) CallsTo(method string, path string) []Call {
+	var calls []Call
+	for _, c := range s.Calls() {
+		if c.Method == method && c.Path == path {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Reset forgets recorded calls and stored users, targets and emails
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = nil
+	s.users = make(map[string]map[string]interface{})
+	s.targets = make(map[string]map[string]interface{})
+	s.emails = make(map[string]map[string]map[string]interface{})
+}
+
+// User returns a copy of the stored user with the given email, nil if there is none
+func (s *Server) User(email string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[email]
+	if !ok {
+		return nil
+	}
+	c := make(map[string]interface{}, len(u))
+	for k, v := range u {
+		c[k] = v
+	}
+	return c
+}
+
+// SetTarget stores a target as if it had been created through the API
+func (s *Server) SetTarget(target_name string, attribute_list []map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.targets[target_name] = map[string]interface{}{"name": target_name, "attributes": toInterfaceList(attribute_list)}
+}
+
+// SetTargetEmail stores a target email as if it had been created through the API.
+// The target is created when it does not exist.
+func (s *Server) SetTargetEmail(target_name string, email_id string, subject string, html_body string, plain_body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.targets[target_name]; !ok {
+		s.targets[target_name] = map[string]interface{}{"name": target_name, "attributes": []interface{}{}}
+	}
+	s.storeEmail(target_name, email_id, map[string]interface{}{"subject": subject, "html": html_body, "plain": plain_body})
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	call := Call{Method: r.Method, Path: strings.TrimPrefix(r.URL.Path, "/"+s.apiVersion), Header: r.Header.Clone()}
+	status, body := s.handle(r, &call)
+	call.StatusCode = status
+
+	s.mu.Lock()
+	s.calls = append(s.calls, call)
+	s.mu.Unlock()
+
+	switch body := body.(type) {
+	case string:
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+func (s *Server) handle(r *http.Request, call *Call) (int, interface{}) {
+	signed, err := s.verifier.Verify(r)
+	if err != nil {
+		return http.StatusUnauthorized, "Unauthorized"
+	}
+	if len(signed.Payload) > 0 {
+		if err := json.Unmarshal(signed.Payload, &call.Payload); err != nil {
+			return http.StatusBadRequest, errorBody("body is not JSON")
+		}
+	}
+	if !strings.HasPrefix(r.URL.Path, "/"+s.apiVersion+"/") {
+		return http.StatusNotFound, errorBody("unknown API version")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status, body := s.route(r.Method, strings.Split(strings.Trim(call.Path, "/"), "/"), call.Payload)
+	// encode while holding the lock, body may reference stored data
+	out, err := json.Marshal(body)
+	if err != nil {
+		return http.StatusInternalServerError, err.Error()
+	}
+	return status, json.RawMessage(out)
+}
+
+// lookupSecret resolves credentials registered with AddCredentials
+func (s *Server) lookupSecret(api_key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	secret, ok := s.credentials[api_key]
+	if !ok {
+		return "", fmt.Errorf("unknown API key %q", api_key)
+	}
+	return secret, nil
+}
+
+func (s *Server) route(method string, parts []string, payload map[string]interface{}) (int, interface{}) {
+	switch {
+	case len(parts) == 2 && parts[0] == "user":
+		return s.handleUser(method, parts[1], payload)
+	case len(parts) == 1 && parts[0] == "account" && method == "GET":
+		return http.StatusOK, s.account
+	case len(parts) == 2 && parts[0] == "account" && parts[1] == "me" && method == "POST":
+		return s.handleAccount(payload)
+	case len(parts) == 2 && parts[0] == "target":
+		return s.handleTarget(method, parts[1], payload)
+	case len(parts) >= 3 && parts[0] == "target" && parts[2] == "email":
+		if _, ok := s.targets[parts[1]]; !ok {
+			return http.StatusNotFound, errorBody("target not found")
+		}
+		return s.handleTargetEmail(method, parts[1], parts[3:], payload)
+	}
+	return http.StatusNotFound, errorBody("not found")
+}
+
+func (s *Server) handleUser(method string, email string, payload map[string]interface{}) (int, interface{}) {
+	if method == "GET" {
+		if u, ok := s.users[email]; ok {
+			return http.StatusOK, u
+		}
+		return http.StatusNotFound, errorBody("user not found")
+	}
+
+	attributes := make(map[string]interface{})
+	properties := make(map[string]interface{})
+	for k, v := range payload {
+		if k == "properties" {
+			if p, ok := v.(map[string]interface{}); ok {
+				properties = p
+			}
+			continue
+		}
+		attributes[k] = v
+	}
+	u := map[string]interface{}{"email": email, "attributes": attributes, "properties": properties}
+	s.users[email] = u
+	return http.StatusOK, u
+}
+
+func (s *Server) handleAccount(payload map[string]interface{}) (int, interface{}) {
+	method := map[string]interface{}{"type": payload["type"]}
+	switch payload["type"] {
+	case turretIO.OUTGOING_METHOD_TURRET_IO_NAME:
+	case turretIO.OUTGOING_METHOD_AWS_NAME, turretIO.OUTGOING_METHOD_SMTP_NAME:
+		options, ok := payload["options"].(map[string]interface{})
+		if !ok {
+			return http.StatusBadRequest, errorBody("options required")
+		}
+		method["options"] = options
+	default:
+		return http.StatusBadRequest, errorBody("invalid outgoing method")
+	}
+	s.account["outgoing_method"] = method
+	return http.StatusOK, s.account
+}
+
+func (s *Server) handleTarget(method string, target_name string, payload map[string]interface{}) (int, interface{}) {
+	if method == "GET" {
+		if t, ok := s.targets[target_name]; ok {
+			return http.StatusOK, t
+		}
+		return http.StatusNotFound, errorBody("target not found")
+	}
+	attributes, ok := payload["attributes"].([]interface{})
+	if !ok {
+		return http.StatusBadRequest, errorBody("attributes must be a list")
+	}
+	t := map[string]interface{}{"name": target_name, "attributes": attributes}
+	s.targets[target_name] = t
+	return http.StatusOK, t
+}
+
+func (s *Server) handleTargetEmail(method string, target_name string, rest []string, payload map[string]interface{}) (int, interface{}) {
+	if len(rest) == 0 {
+		if method != "POST" {
+			return http.StatusNotFound, errorBody("not found")
+		}
+		s.nextID++
+		return http.StatusOK, s.storeEmail(target_name, fmt.Sprintf("%08x", s.nextID), payload)
+	}
+
+	email, ok := s.emails[target_name][rest[0]]
+	if !ok {
+		return http.StatusNotFound, errorBody("email not found")
+	}
+	switch {
+	case len(rest) == 1 && method == "GET":
+		return http.StatusOK, email
+	case len(rest) == 1 && method == "POST":
+		return http.StatusOK, s.storeEmail(target_name, rest[0], payload)
+	case len(rest) == 2 && method == "POST" && (rest[1] == "send" || rest[1] == "sendTestEmail"):
+		if from, _ := payload["email_from"].(string); from == "" {
+			return http.StatusBadRequest, errorBody("email_from required")
+		}
+		if to, _ := payload["recipient"].(string); rest[1] == "sendTestEmail" && to == "" {
+			return http.StatusBadRequest, errorBody("recipient required")
+		}
+		return http.StatusOK, map[string]interface{}{"status": "queued"}
+	}
+	return http.StatusNotFound, errorBody("not found")
+}
+
+func (s *Server) storeEmail(target_name string, email_id string, payload map[string]interface{}) map[string]interface{} {
+	if s.emails[target_name] == nil {
+		s.emails[target_name] = make(map[string]map[string]interface{})
+	}
+	e := map[string]interface{}{
+		"id":      email_id,
+		"target":  target_name,
+		"subject": payload["subject"],
+		"html":    payload["html"],
+		"plain":   payload["plain"],
+	}
+	s.emails[target_name][email_id] = e
+	return e
+}
+
+func errorBody(msg string) map[string]interface{} {
+	return map[string]interface{}{"error": msg}
+}
+
+func toInterfaceList(attribute_list []map[string]interface{}) []interface{} {
+	l := make([]interface{}, len(attribute_list))
+	for i, a := range attribute_list {
+		l[i] = a
+	}
+	return l
+}
@@ -0,0 +1,228 @@
+// Copyright 2014 Loop Science
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turretIO
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DEFAULT_MAX_SKEW = 5 * time.Minute
+
+// DEFAULT_MAX_BODY_BYTES is the largest request body Verify reads, base64 encoded
+const DEFAULT_MAX_BODY_BYTES = 4 << 20
+
+// canonicalString is the string signed by X-Ls-Auth: the request path relative
+// to the base URL, the JSON payload and the unix timestamp sent in X-Ls-Time
+func canonicalString(path string, body []byte, timestamp int64) string {
+	return path + string(body) + strconv.FormatInt(timestamp, 10)
+}
+
+func computeSignature(api_secret string, path string, body []byte, timestamp int64) ([]byte, error) {
+	k, err := base64.StdEncoding.DecodeString(api_secret)
+	if err != nil {
+		return nil, err
+	}
+	h := hmac.New(sha512.New, k)
+	h.Write([]byte(canonicalString(path, body, timestamp)))
+	return h.Sum(nil), nil
+}
+
+// signRequest returns the base64 encoded X-Ls-Auth value for a request
+func signRequest(api_secret string, path string, body []byte, timestamp int64) (string, error) {
+	sig, err := computeSignature(api_secret, path, body, timestamp)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// SecretLookup returns the base64 encoded API secret for an API key, or an
+// error if the key is unknown
+type SecretLookup func(api_key string) (string, error)
+
+// SignedRequest is a request that passed Verifier.Verify
+type SignedRequest struct {
+	APIKey    string
+	Timestamp time.Time
+	// Payload is the decoded JSON body
+	Payload []byte
+}
+
+// Verifier checks Turret.IO style signed requests on the receiving side,
+// e.g. in a proxy or webhook receiver
+type Verifier struct {
+	Lookup SecretLookup
+	// MaxSkew is the largest accepted difference between X-Ls-Time and the
+	// local clock. Defaults to DEFAULT_MAX_SKEW.
+	MaxSkew time.Duration
+	// StripPrefix is removed from the request path before verification, for
+	// servers mounted below the base URL the client was configured with
+	StripPrefix string
+	// MaxBodyBytes is the largest accepted body. Defaults to DEFAULT_MAX_BODY_BYTES.
+	MaxBodyBytes int64
+	// DisableReplayCheck accepts the same signed request more than once.
+	// The signature only covers the path, payload and a timestamp with one
+	// second resolution, so two identical requests signed within the same
+	// second are indistinguishable from a replay. TurretIO signs the retries
+	// of a call with increasing timestamps so they are not rejected, but
+	// separate identical calls made within one second are. Disable the check
+	// if clients legitimately make such calls.
+	DisableReplayCheck bool
+	// Now returns the current time, defaults to time.Now
+	Now func() time.Time
+
+	mu sync.Mutex
+	// seen maps the signatures of accepted requests to when they were seen,
+	// expiry lists them in that order so expired ones are dropped from the front
+	seen   map[string]time.Time
+	expiry []seenSignature
+}
+
+type seenSignature struct {
+	key string
+	at  time.Time
+}
+
+// NewVerifier creates a Verifier resolving API secrets with lookup
+func NewVerifier(lookup SecretLookup) *Verifier {
+	return &Verifier{Lookup: lookup}
+}
+
+// Verify checks the X-Ls-Key, X-Ls-Time and X-Ls-Auth headers of r against
+// its path and body. The body of r is restored so it can be read again.
+func (v *Verifier) Verify(r *http.Request) (*SignedRequest, error) {
+	api_key := r.Header.Get("X-Ls-Key")
+	sig, err := base64.StdEncoding.DecodeString(r.Header.Get("X-Ls-Auth"))
+	if api_key == "" || len(sig) == 0 || err != nil {
+		return nil, fmt.Errorf("%w: missing or malformed signature headers", ErrInvalidSignature)
+	}
+	unix, err := strconv.ParseInt(r.Header.Get("X-Ls-Time"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed X-Ls-Time", ErrInvalidSignature)
+	}
+
+	now := v.now()
+	timestamp := time.Unix(unix, 0)
+	if skew := now.Sub(timestamp); skew > v.maxSkew() || skew < -v.maxSkew() {
+		return nil, fmt.Errorf("%w: timestamp off by %s", ErrStaleRequest, skew)
+	}
+
+	raw, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, v.maxBodyBytes()))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrBodyTooLarge, tooLarge.Limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(raw))
+	payload, err := base64.StdEncoding.DecodeString(string(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%w: body is not base64 encoded", ErrInvalidSignature)
+	}
+
+	api_secret, err := v.Lookup(api_key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSignature, err)
+	}
+	path := strings.TrimPrefix(r.URL.Path, v.StripPrefix)
+	expected, err := computeSignature(api_secret, path, payload, unix)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(sig, expected) {
+		return nil, ErrInvalidSignature
+	}
+
+	if !v.DisableReplayCheck && !v.remember(api_key+":"+string(sig), now) {
+		return nil, ErrReplayedRequest
+	}
+	return &SignedRequest{APIKey: api_key, Timestamp: timestamp, Payload: payload}, nil
+}
+
+// Middleware answers 401 Unauthorized to requests failing Verify and passes
+// the others on to next
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := v.Verify(r); errors.Is(err, ErrBodyTooLarge) {
+			http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+			return
+		} else if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// remember records a signature and reports whether it was new. Signatures
+// older than twice the skew window are dropped since Verify rejects them anyway.
+func (v *Verifier) remember(key string, now time.Time) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.seen == nil {
+		v.seen = make(map[string]time.Time)
+	}
+	expired := 0
+	for _, e := range v.expiry {
+		if now.Sub(e.at) <= 2*v.maxSkew() {
+			break
+		}
+		if v.seen[e.key].Equal(e.at) {
+			delete(v.seen, e.key)
+		}
+		expired++
+	}
+	v.expiry = v.expiry[expired:]
+	if _, ok := v.seen[key]; ok {
+		return false
+	}
+	v.seen[key] = now
+	v.expiry = append(v.expiry, seenSignature{key: key, at: now})
+	return true
+}
+
+func (v *Verifier) now() time.Time {
+	if v.Now != nil {
+		return v.Now()
+	}
+	return time.Now()
+}
+
+func (v *Verifier) maxBodyBytes() int64 {
+	if v.MaxBodyBytes > 0 {
+		return v.MaxBodyBytes
+	}
+	return DEFAULT_MAX_BODY_BYTES
+}
+
+func (v *Verifier) maxSkew() time.Duration {
+	if v.MaxSkew > 0 {
+		return v.MaxSkew
+	}
+	return DEFAULT_MAX_SKEW
+}